@@ -0,0 +1,431 @@
+/**
+ * Package compiler compiles DNS blocklists, it is what the compile
+ * command runs:
+ *
+ *	result, err := compiler.Compile(ctx, compiler.Config{
+ *		Name:    "My list",
+ *		Sources: []compiler.Source{{Name: "Ads", Source: "https://example.org/ads.txt"}},
+ *	}, compiler.WithFormat(format.HOSTS))
+ */
+package compiler
+
+import (
+	"context"
+	"dns-hostlist-compiler/modules/app/pipeline"
+	"dns-hostlist-compiler/modules/compress"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/format"
+	"dns-hostlist-compiler/modules/guard"
+	"dns-hostlist-compiler/modules/header"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/transform"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	INTEGRITY_FAIL = config.INTEGRITY_FAIL
+	INTEGRITY_WARN = config.INTEGRITY_WARN
+)
+
+type (
+	Breach      = guard.Breach
+	GuardCounts = guard.Counts
+	GuardError  = guard.Error
+)
+
+type (
+	Config        = config.Config
+	List          = config.List
+	Output        = config.Output
+	Source        = config.Source
+	SourceStats   = pipeline.SourceStats
+	StageMetrics  = pipeline.StageMetrics
+	ParsedSources = pipeline.ParsedSources
+)
+
+const (
+	ERROR   = "error"
+	WARNING = "warning"
+)
+
+// Diagnostic is a problem found while compiling that did not stop the build
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	// Name of the source the problem comes from, empty for the whole list
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+}
+
+// OutputResult is an output of the config rendered from the build
+type OutputResult struct {
+	Output
+	// The list as it is written to the file, with the header
+	Lines []string
+	// The rules in the format of the output, after its transformations
+	Rules []string
+}
+
+type Result struct {
+	// The compiled list as it is written to the output, with the header.
+	// With outputs in the config, that of the first one.
+	Lines []string
+	// The rules of the list in the output format, without the header
+	Rules       []string
+	Sources     []SourceStats
+	Stages      []StageMetrics
+	Diagnostics []Diagnostic
+	// The outputs of the config, in order
+	Outputs []OutputResult
+	// Guards breached by the build when cfg.Guard.OnBreach is
+	// config.GUARD_KEEP, with GUARD_FAIL Compile returns a *GuardError
+	Breaches []Breach
+	// Time of the build, from the clock
+	Started time.Time
+	// Time written to the header, the time of the lock with WithLockfile
+	// so that the locked builds are the same
+	Updated       time.Time
+	Duration      time.Duration
+	PeakHeapInUse uint64
+}
+
+func (r *Result) warn(source string, format string, a ...any) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Severity: WARNING, Source: source, Message: fmt.Sprintf(format, a...)})
+}
+
+/**
+ * Number of rules of the list and its sources, for the guards of the next
+ * build. With outputs these are the rules of the first one, the file the
+ * counts are read back from when they are not cached.
+ */
+func (r *Result) Counts() GuardCounts {
+	var counts GuardCounts = GuardCounts{Rules: len(r.Rules)}
+	for _, source := range r.Sources {
+		counts.AddSource(source.Name, source.URL, source.Rules)
+	}
+	return counts
+}
+
+// Report is the JSON summary of the build, everything but the rules
+func (r *Result) Report() pipeline.RunReport {
+	return pipeline.RunReport{
+		Started:       r.Started.UTC(),
+		Duration:      r.Duration,
+		Rules:         len(r.Rules),
+		PeakHeapInUse: r.PeakHeapInUse,
+		Sources:       r.Sources,
+		Stages:        r.Stages,
+	}
+}
+
+/**
+ * The default fetchers with the HTTP client set up from the config,
+ * or fetch.Default itself when nothing is set.
+ */
+func httpFetcher(settings config.HTTP) (Fetcher, error) {
+	if settings == (config.HTTP{}) {
+		return fetch.Default, nil
+	}
+
+	web, err := fetch.NewHTTPFetcherWithOptions(fetch.HTTPOptions{
+		UserAgent: settings.UserAgent,
+		Proxy:     settings.Proxy,
+		CABundle:  settings.CABundle,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var registry *fetch.Registry = fetch.Default.Clone()
+	registry.Register("http", web)
+	registry.Register("https", web)
+	return registry, nil
+}
+
+/**
+ * Returns the fetcher Compile uses for the config when it is not given
+ * WithFetcher, for the callers wrapping it.
+ */
+func NewFetcher(cfg Config) (Fetcher, error) {
+	return httpFetcher(cfg.HTTP)
+}
+
+// Headers and credentials of a source, the secret is read here
+func requestOptions(source config.Source) (fetch.RequestOptions, error) {
+	var request fetch.RequestOptions = fetch.RequestOptions{Headers: source.Headers}
+	if source.Auth == nil {
+		return request, nil
+	}
+
+	secret, err := fetch.ReadSecret(source.Auth.Env, source.Auth.File)
+	if err != nil {
+		return request, fmt.Errorf("%s auth: %w", source.Auth.Type, err)
+	}
+	request.Credentials = &fetch.Credentials{Type: source.Auth.Type, Username: source.Auth.Username, Secret: secret}
+	return request, nil
+}
+
+// The smallest maxBytes of the build and the source, 0 when neither has one
+func maxBytes(limits config.Limits, sourceLimits *config.Limits) int64 {
+	var max int64 = limits.MaxBytes
+	if sourceLimits != nil && sourceLimits.MaxBytes > 0 && (max == 0 || sourceLimits.MaxBytes < max) {
+		max = sourceLimits.MaxBytes
+	}
+	return max
+}
+
+/**
+ * Returns the function that opens a source of the config and the files
+ * it includes, with the headers and credentials of the source.
+ * The other tools reading the sources use it to fetch them the way
+ * Compile does, only WithFetcher and WithLogger are used.
+ */
+func SourceOpener(ctx context.Context, cfg Config, opts ...Option) (func(source Source) preprocessor.Opener, error) {
+	var o options = defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	fetcher, err := sourceFetcher(cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return sourceOpener(ctx, cfg.Limits, fetcher, o), nil
+}
+
+// The fetcher of the lockfile, the one given WithFetcher or the default one
+func sourceFetcher(cfg Config, o options) (Fetcher, error) {
+	if o.lockfile != nil {
+		return o.lockfile.Fetcher(o.store), nil
+	}
+	if o.fetcher != nil {
+		return o.fetcher, nil
+	}
+	return httpFetcher(cfg.HTTP)
+}
+
+func sourceOpener(ctx context.Context, limits config.Limits, fetcher Fetcher, o options) func(source Source) preprocessor.Opener {
+	return func(source Source) preprocessor.Opener {
+		var request fetch.RequestOptions
+		var err error
+		if o.lockfile == nil {
+			request, err = requestOptions(source)
+		}
+		request.MaxBytes = maxBytes(limits, source.Limits)
+		var sourceCtx context.Context = fetch.WithRequestOptions(ctx, request)
+
+		return func(location string) (io.ReadCloser, error) {
+			if err != nil {
+				return nil, fmt.Errorf("source %s: %w", source.Name, err)
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			o.logger.Debug("fetch", "source", source.Name, "url", fetch.Redact(location))
+			return fetcher.Fetch(sourceCtx, location)
+		}
+	}
+}
+
+/**
+ * Downloads the sources of the config, runs them through the
+ * transformations and renders the list with its header.
+ *
+ * The context is checked every time a source or an included file is
+ * opened and is passed on to the fetcher.
+ * A source that does not match its sha256 fails the build, or is a
+ * warning when cfg.Integrity is config.INTEGRITY_WARN.
+ * The rule counts are checked against the guards of the config and the
+ * previous build given WithPreviousBuild.
+ */
+func Compile(ctx context.Context, cfg Config, opts ...Option) (*Result, error) {
+	var o options = defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if len(cfg.Lists) > 0 {
+		return nil, fmt.Errorf("the config defines lists, they are compiled with CompileLists")
+	}
+	if err := format.Validate(o.format); err != nil {
+		return nil, err
+	}
+
+	fetcher, err := sourceFetcher(cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return compile(ctx, cfg, fetcher, o)
+}
+
+func compile(ctx context.Context, cfg Config, fetcher Fetcher, o options) (*Result, error) {
+	var open func(source Source) preprocessor.Opener = sourceOpener(ctx, cfg.Limits, fetcher, o)
+	var result *Result = &Result{Started: o.clock()}
+	result.Updated = result.Started
+	if o.lockfile != nil {
+		result.Updated = o.lockfile.Created
+	}
+	var keepSubdomains bool = writesHosts(cfg, o)
+	compiled, err := pipeline.RunPipeline(ctx, cfg.Sources, pipeline.Options{
+		Platforms:      o.platforms,
+		Logger:         o.logger,
+		Open:           open,
+		Integrity:      cfg.Integrity,
+		Limits:         cfg.Limits,
+		KeepSubdomains: keepSubdomains,
+		Parsed:         o.parsed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Sources = compiled.Sources
+	result.Stages = compiled.Stages
+	result.Duration = compiled.Duration
+	result.PeakHeapInUse = compiled.PeakHeapInUse
+	for _, source := range compiled.Sources {
+		if source.Rules == 0 {
+			result.warn(source.Name, "%s has no rules", source.URL)
+		}
+		if source.Truncated != "" {
+			result.warn(source.Name, "%s, it was truncated", source.Truncated)
+		}
+		if source.Integrity == pipeline.MISMATCH {
+			result.warn(source.Name, "%s does not match its sha256, got %s", source.URL, source.SHA256)
+		}
+	}
+
+	transformed, err := transform.Apply(compiled.Rules, cfg.Transformations)
+	if err != nil {
+		return nil, err
+	}
+	for _, output := range cfg.Outputs {
+		rendered, err := renderOutput(cfg, result, transformed, output, o.format, keepSubdomains)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", output.Path, err)
+		}
+		result.Outputs = append(result.Outputs, rendered)
+	}
+
+	// The list is the first output, without outputs it is rendered in the format of the options
+	if len(result.Outputs) > 0 {
+		result.Rules = result.Outputs[0].Rules
+		result.Lines = result.Outputs[0].Lines
+	} else {
+		rules, dropped := render(transformed, o.format, keepSubdomains)
+		if dropped > 0 {
+			result.warn("", "%d rules cannot be written in the %s format", dropped, o.format)
+		}
+		result.Rules = rules
+		result.Lines = addHeader(cfg, result, o.format, cfg.Header, cfg.Checksum, rules)
+	}
+
+	if breaches := guard.Check(cfg, result.Counts(), o.previous); len(breaches) > 0 {
+		if cfg.Guard.OnBreach != config.GUARD_KEEP {
+			return nil, &GuardError{Breaches: breaches}
+		}
+		result.Breaches = breaches
+		for _, breach := range breaches {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{Severity: ERROR, Source: breach.Source, Message: breach.String()})
+		}
+	}
+
+	for _, diagnostic := range result.Diagnostics {
+		if diagnostic.Severity == ERROR {
+			o.logger.Error(diagnostic.Message, "source", diagnostic.Source)
+		} else {
+			o.logger.Warn(diagnostic.Message, "source", diagnostic.Source)
+		}
+	}
+	return result, nil
+}
+
+/**
+ * Renders an output of the config from the compiled rules: the extra
+ * transformations, the format and the header. An output without a format
+ * is written in the format of the options.
+ */
+func renderOutput(cfg Config, result *Result, compiled []string, output Output, defaultFormat string, keepSubdomains bool) (OutputResult, error) {
+	var rendered OutputResult = OutputResult{Output: output}
+	if rendered.Format == "" {
+		rendered.Format = defaultFormat
+	}
+
+	transformed, err := transform.Apply(compiled, output.Transformations)
+	if err != nil {
+		return rendered, err
+	}
+
+	rules, dropped := render(transformed, rendered.Format, keepSubdomains)
+	if dropped > 0 {
+		result.warn("", "%d rules cannot be written in the %s format of %s", dropped, rendered.Format, output.Path)
+	}
+
+	var withHeader, withChecksum bool = cfg.Header, cfg.Checksum
+	if output.Header != nil {
+		withHeader = *output.Header
+	}
+	if output.Checksum != nil {
+		withChecksum = *output.Checksum
+	}
+
+	rendered.Rules = rules
+	rendered.Lines = addHeader(cfg, result, rendered.Format, withHeader, withChecksum, rules)
+	return rendered, nil
+}
+
+// Whether the list or one of its outputs is written as a hosts file
+func writesHosts(cfg Config, o options) bool {
+	if o.format == format.HOSTS {
+		return true
+	}
+	for _, output := range cfg.Outputs {
+		if output.Format == format.HOSTS {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Writes the rules in the given format. When the pipeline kept the rules
+ * on subdomains for a hosts file, the other formats are compressed here
+ * since their rules block the subdomains.
+ */
+func render(rules []string, outputFormat string, keepSubdomains bool) ([]string, int) {
+	if keepSubdomains && outputFormat != format.HOSTS {
+		rules = compress.Compress(rules)
+	}
+	return format.Render(rules, outputFormat)
+}
+
+// The rules with the metadata header and the checksum when they are asked for
+func addHeader(cfg Config, result *Result, outputFormat string, withHeader bool, withChecksum bool, rules []string) []string {
+	if !withHeader && !withChecksum {
+		return rules
+	}
+
+	var meta header.Metadata = header.Metadata{
+		Title:       cfg.Name,
+		Description: cfg.Description,
+		Homepage:    cfg.Homepage,
+		License:     cfg.License,
+		Version:     cfg.Version,
+		TimeUpdated: result.Updated,
+		Expires:     cfg.Expires,
+	}
+	for _, source := range result.Sources {
+		meta.Sources = append(meta.Sources, header.SourceSummary{Name: source.Name, URL: source.URL, Rules: source.Rules})
+	}
+
+	var comment string = format.CommentPrefix(outputFormat)
+	var lines []string = append(header.Build(meta, comment), rules...)
+	if withChecksum {
+		lines = header.AddChecksum(lines, comment)
+	}
+	return lines
+}
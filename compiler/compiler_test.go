@@ -0,0 +1,273 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/format"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFetcher() *fetch.Memory {
+	return fetch.NewMemory(map[string]string{
+		"mem://lists/ads.txt":   "! ads\n||ads.example.org^\n0.0.0.0 tracker.example.net\n!#include extra.txt\n",
+		"mem://lists/extra.txt": "@@||allowed.example.org^\n",
+		"mem://lists/empty.txt": "! nothing here\n",
+	})
+}
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+}
+
+func TestCompile(t *testing.T) {
+	var fetcher *fetch.Memory = testFetcher()
+	var clock = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	result, err := Compile(context.Background(), Config{
+		Name:   "Test list",
+		Header: true,
+		Sources: []Source{
+			{Name: "Ads", Source: "mem://lists/ads.txt"},
+			{Name: "Empty", Source: "mem://lists/empty.txt"},
+		},
+	}, WithFetcher(fetcher), WithClock(clock), WithLogger(quietLogger()), WithFormat(format.HOSTS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"mem://lists/ads.txt", "mem://lists/extra.txt", "mem://lists/empty.txt"}; !reflect.DeepEqual(fetcher.Fetched(), want) {
+		t.Errorf("fetched %q, want %q", fetcher.Fetched(), want)
+	}
+	if want := []string{"0.0.0.0 ads.example.org", "0.0.0.0 tracker.example.net"}; !reflect.DeepEqual(result.Rules, want) {
+		t.Errorf("Rules = %q, want %q", result.Rules, want)
+	}
+	if !reflect.DeepEqual(result.Lines[len(result.Lines)-2:], result.Rules) || !strings.HasPrefix(result.Lines[1], "# Title: Test list") {
+		t.Errorf("Lines = %q", result.Lines)
+	}
+	if !result.Started.Equal(clock()) || !strings.Contains(strings.Join(result.Lines, "\n"), "# TimeUpdated: 2024-05-01T12:00:00Z") {
+		t.Errorf("build time = %v, lines = %q", result.Started, result.Lines)
+	}
+
+	var want []Diagnostic = []Diagnostic{
+		{Severity: WARNING, Source: "Empty", Message: "mem://lists/empty.txt has no rules"},
+		{Severity: WARNING, Message: "1 rules cannot be written in the hosts format"},
+	}
+	if !reflect.DeepEqual(result.Diagnostics, want) {
+		t.Errorf("Diagnostics = %+v, want %+v", result.Diagnostics, want)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	var fetcher Option = WithFetcher(testFetcher())
+
+	if _, err := Compile(context.Background(), Config{}, fetcher); err == nil {
+		t.Errorf("Compile() without sources error = nil")
+	}
+
+	var missing Config = Config{Sources: []Source{{Source: "mem://lists/missing.txt"}}}
+	if _, err := Compile(context.Background(), missing, fetcher, WithLogger(quietLogger())); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Compile() of a missing source error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var ads Config = Config{Sources: []Source{{Source: "mem://lists/ads.txt"}}}
+	if _, err := Compile(ctx, ads, fetcher, WithLogger(quietLogger())); !errors.Is(err, context.Canceled) {
+		t.Errorf("Compile() with a cancelled context error = %v", err)
+	}
+
+	if _, err := Compile(context.Background(), ads, fetcher, WithFormat("unbound")); err == nil {
+		t.Errorf("Compile() with an unknown format error = nil")
+	}
+}
+
+func TestCompileIntegrity(t *testing.T) {
+	const pinned = "0000000000000000000000000000000000000000000000000000000000000000"
+	var cfg Config = Config{Sources: []Source{{Name: "Empty", Source: "mem://lists/empty.txt", SHA256: pinned}}}
+
+	if _, err := Compile(context.Background(), cfg, WithFetcher(testFetcher()), WithLogger(quietLogger())); err == nil || !strings.Contains(err.Error(), "does not match its sha256") {
+		t.Errorf("Compile() error = %v, want a sha256 mismatch", err)
+	}
+
+	cfg.Integrity = INTEGRITY_WARN
+	result, err := Compile(context.Background(), cfg, WithFetcher(testFetcher()), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last Diagnostic = result.Diagnostics[len(result.Diagnostics)-1]
+	if last.Source != "Empty" || !strings.Contains(last.Message, "does not match its sha256, got "+result.Sources[0].SHA256) {
+		t.Errorf("Diagnostics = %+v", result.Diagnostics)
+	}
+}
+
+func TestCompileGuard(t *testing.T) {
+	var cfg Config = Config{
+		Guard:   config.ListGuard{Guard: config.Guard{MaxChangePercent: 50}},
+		Sources: []Source{{Name: "Ads", Source: "mem://lists/ads.txt", Guard: &config.Guard{MinRules: 1}}},
+	}
+	var fetcher Option = WithFetcher(testFetcher())
+
+	first, err := Compile(context.Background(), cfg, fetcher, WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (GuardCounts{Rules: 3, Sources: map[string]int{"Ads": 3}}); !reflect.DeepEqual(first.Counts(), want) {
+		t.Errorf("Counts() = %+v, want %+v", first.Counts(), want)
+	}
+
+	var shrunk *fetch.Memory = testFetcher()
+	shrunk.Set("mem://lists/ads.txt", "! broken upstream\n")
+	var guardErr *GuardError
+	if _, err := Compile(context.Background(), cfg, WithFetcher(shrunk), WithPreviousBuild(first.Counts()), WithLogger(quietLogger())); !errors.As(err, &guardErr) || len(guardErr.Breaches) != 2 || guardErr.Breaches[0].Source != "Ads" {
+		t.Errorf("Compile() error = %v, want the Ads and list guards breached", err)
+	}
+
+	cfg.Guard.OnBreach = config.GUARD_KEEP
+	kept, err := Compile(context.Background(), cfg, WithFetcher(shrunk), WithPreviousBuild(first.Counts()), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept.Breaches) != 2 || kept.Diagnostics[len(kept.Diagnostics)-1].Severity != ERROR {
+		t.Errorf("Breaches = %+v, Diagnostics = %+v", kept.Breaches, kept.Diagnostics)
+	}
+}
+
+func TestCompileOutputs(t *testing.T) {
+	var noHeader bool = false
+	var cfg Config = Config{
+		Name:    "Test list",
+		Header:  true,
+		Sources: []Source{{Name: "Ads", Source: "mem://lists/ads.txt"}},
+		Outputs: []Output{
+			{Path: "list.txt"},
+			{Path: "dnsmasq.conf", Format: format.DNSMASQ, Header: &noHeader, Transformations: []string{"removeallowrules", "sort"}, Gzip: true},
+		},
+	}
+
+	result, err := Compile(context.Background(), cfg, WithFetcher(testFetcher()), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Outputs) != 2 {
+		t.Fatalf("Outputs = %+v", result.Outputs)
+	}
+
+	var adblock OutputResult = result.Outputs[0]
+	if adblock.Format != format.ADBLOCK || !strings.HasPrefix(adblock.Lines[1], "! Title: Test list") || !reflect.DeepEqual(adblock.Rules, result.Rules) {
+		t.Errorf("Outputs[0] = %+v", adblock)
+	}
+
+	var dnsmasq OutputResult = result.Outputs[1]
+	if want := []string{"address=/ads.example.org/#", "address=/tracker.example.net/#"}; !reflect.DeepEqual(dnsmasq.Lines, want) || !dnsmasq.Gzip {
+		t.Errorf("Outputs[1] = %+v, want the lines %q", dnsmasq, want)
+	}
+}
+
+func TestCompileOutputsDefaultFormat(t *testing.T) {
+	var cfg Config = Config{
+		Sources: []Source{{Name: "Ads", Source: "mem://lists/ads.txt"}},
+		Outputs: []Output{{Path: "hosts.txt"}, {Path: "list.txt", Format: format.ADBLOCK}},
+	}
+
+	result, err := Compile(context.Background(), cfg, WithFetcher(testFetcher()), WithFormat(format.HOSTS), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Outputs[0].Format != format.HOSTS || result.Outputs[1].Format != format.ADBLOCK {
+		t.Errorf("output formats = %s and %s, want hosts and adblock", result.Outputs[0].Format, result.Outputs[1].Format)
+	}
+	// The list is the first output
+	if !reflect.DeepEqual(result.Lines, result.Outputs[0].Lines) || !reflect.DeepEqual(result.Rules, result.Outputs[0].Rules) {
+		t.Errorf("Lines = %q, want those of the first output %q", result.Lines, result.Outputs[0].Lines)
+	}
+}
+
+func TestCompileHostsKeepsSubdomains(t *testing.T) {
+	var fetcher *fetch.Memory = fetch.NewMemory(map[string]string{
+		"mem://lists/hosts.txt": "||example.org^\n||ads.example.org^\n0.0.0.0 tracker.example.org\n||foo.com^\n",
+	})
+	var cfg Config = Config{
+		Sources: []Source{{Name: "Hosts", Source: "mem://lists/hosts.txt"}},
+		Outputs: []Output{{Path: "hosts.txt", Format: format.HOSTS}, {Path: "list.txt"}},
+	}
+
+	result, err := Compile(context.Background(), cfg, WithFetcher(fetcher), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0.0.0.0 example.org", "0.0.0.0 ads.example.org", "0.0.0.0 tracker.example.org", "0.0.0.0 foo.com"}; !reflect.DeepEqual(result.Outputs[0].Lines, want) {
+		t.Errorf("hosts output = %q, want %q", result.Outputs[0].Lines, want)
+	}
+	// The rules on the subdomains are only kept for the hosts file
+	if want := []string{"||example.org^", "||foo.com^"}; !reflect.DeepEqual(result.Outputs[1].Lines, want) {
+		t.Errorf("adblock output = %q, want %q", result.Outputs[1].Lines, want)
+	}
+}
+
+func TestCompileWithAuth(t *testing.T) {
+	t.Setenv("TEST_LIST_TOKEN", "s3cr3t-token")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("User-Agent")+" "+r.Header.Get("X-Team"))
+		if r.Header.Get("Authorization") != "Bearer s3cr3t-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/main.txt":
+			io.WriteString(w, "||main.example.org^\n!#include included.txt\n")
+		case "/included.txt":
+			io.WriteString(w, "||included.example.org^\n")
+		}
+	}))
+	defer server.Close()
+
+	var cfg Config = Config{
+		Header: true,
+		HTTP:   config.HTTP{UserAgent: "test-agent"},
+		Sources: []Source{{
+			Name:    "Internal",
+			Source:  strings.Replace(server.URL, "http://", "http://reader:pa55word@", 1) + "/main.txt",
+			Headers: map[string]string{"X-Team": "dns"},
+			Auth:    &config.Auth{Type: config.AUTH_BEARER, Env: "TEST_LIST_TOKEN"},
+		}},
+	}
+
+	var logs bytes.Buffer
+	var logger *slog.Logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	result, err := Compile(context.Background(), cfg, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"/main.txt test-agent dns", "/included.txt test-agent dns"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if want := []string{"||main.example.org^", "||included.example.org^"}; !reflect.DeepEqual(result.Rules, want) {
+		t.Errorf("Rules = %q, want %q", result.Rules, want)
+	}
+
+	var output string = strings.Join(result.Lines, "\n") + logs.String()
+	for _, secret := range []string{"s3cr3t-token", "pa55word", "X-Team"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("%s leaked into the output or the logs:\n%s", secret, output)
+		}
+	}
+
+	t.Setenv("TEST_LIST_TOKEN", "")
+	if _, err := Compile(context.Background(), cfg, WithLogger(quietLogger())); err == nil || strings.Contains(err.Error(), "pa55word") {
+		t.Errorf("Compile() without the token error = %v", err)
+	}
+}
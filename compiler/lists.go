@@ -0,0 +1,103 @@
+package compiler
+
+import (
+	"context"
+	"dns-hostlist-compiler/modules/app/pipeline"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/format"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ListResult is the build of one of the lists of the config
+type ListResult struct {
+	// The list as it was compiled, see config.Config.ListConfig
+	Config Config
+	Result *Result
+	// Why the list was not built, the other lists are built anyway
+	Err error
+}
+
+/**
+ * Compiles the lists of the config, at most WithParallelism of them at the
+ * same time. A source shared by several lists is downloaded and parsed
+ * once, its content and its rules are kept in memory until every list is
+ * built. The results are in the order of the lists, the guards of a list
+ * compare with its counts given WithPreviousBuilds.
+ *
+ * The allocations in the stage metrics are those of the whole process,
+ * they include the other lists being built.
+ */
+func CompileLists(ctx context.Context, cfg Config, opts ...Option) ([]ListResult, error) {
+	var o options = defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if len(cfg.Lists) == 0 {
+		return nil, fmt.Errorf("the config defines no lists")
+	}
+	if err := format.Validate(o.format); err != nil {
+		return nil, err
+	}
+
+	fetcher, err := sourceFetcher(cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	var shared *fetch.Shared = fetch.NewShared(fetcher)
+	if o.parsed == nil {
+		o.parsed = pipeline.NewParsedSources(sharedSources(cfg))
+	}
+
+	var results []ListResult = make([]ListResult, len(cfg.Lists))
+	var slots chan struct{} = make(chan struct{}, o.parallelism)
+	var wg sync.WaitGroup
+	for i, listCfg := range cfg.ListConfigs() {
+		results[i].Config = listCfg
+
+		var listOptions options = o
+		listOptions.logger = o.logger.With("list", listCfg.Name)
+		listOptions.previous = nil
+		if previous, found := o.previousLists[listCfg.Name]; found {
+			listOptions.previous = &previous
+		}
+
+		wg.Add(1)
+		go func(i int, listCfg Config, listOptions options) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i].Result, results[i].Err = compile(ctx, listCfg, shared, listOptions)
+		}(i, listCfg, listOptions)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// Whether a source is used by several lists, the others are not kept in memory
+func sharedSources(cfg Config) func(source Source) bool {
+	var lists map[string]int = make(map[string]int)
+	for _, listCfg := range cfg.ListConfigs() {
+		var seen map[string]bool = make(map[string]bool)
+		for _, source := range listCfg.Sources {
+			if key := sourceKey(source); !seen[key] {
+				seen[key] = true
+				lists[key] += 1
+			}
+		}
+	}
+	return func(source Source) bool {
+		return lists[sourceKey(source)] > 1
+	}
+}
+
+func sourceKey(source Source) string {
+	data, _ := json.Marshal(source)
+	return string(data)
+}
@@ -0,0 +1,53 @@
+package compiler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileLists(t *testing.T) {
+	var fetcher = testFetcher()
+	fetcher.Set("mem://lists/malware.txt", "||malware.example.com^\n")
+	var cfg Config = Config{
+		Sources: []Source{{Name: "Ads", Source: "mem://lists/ads.txt"}},
+		Lists: []List{
+			{Name: "Ads", Outputs: []Output{{Path: "ads.txt"}}, Sources: []Source{{Name: "Ads"}}},
+			{Name: "Malware", Transformations: []string{"removeallowrules"}, Outputs: []Output{{Path: "malware.txt"}}, Sources: []Source{{Name: "Ads"}, {Name: "Malware", Source: "mem://lists/malware.txt"}}},
+			{Name: "Broken", Outputs: []Output{{Path: "broken.txt"}}, Sources: []Source{{Name: "Missing", Source: "mem://lists/missing.txt"}}},
+		},
+	}
+
+	results, err := CompileLists(context.Background(), cfg, WithFetcher(fetcher), WithLogger(quietLogger()), WithParallelism(2),
+		WithPreviousBuilds(map[string]GuardCounts{"Ads": {Rules: 3}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Config.Name != "Ads" || results[2].Config.Name != "Broken" {
+		t.Fatalf("CompileLists() = %+v", results)
+	}
+
+	if results[0].Err != nil || len(results[0].Result.Rules) != 3 {
+		t.Errorf("Ads = %+v, %v", results[0].Result, results[0].Err)
+	}
+	if want := []string{"||ads.example.org^", "||tracker.example.net^", "||malware.example.com^"}; results[1].Err != nil || !reflect.DeepEqual(results[1].Result.Rules, want) {
+		t.Errorf("Malware = %+v, %v, want the rules %q", results[1].Result, results[1].Err, want)
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "missing.txt") {
+		t.Errorf("Broken error = %v", results[2].Err)
+	}
+
+	// The shared source and the file it includes were fetched once
+	var fetched map[string]int = make(map[string]int)
+	for _, location := range fetcher.Fetched() {
+		fetched[location] += 1
+	}
+	if fetched["mem://lists/ads.txt"] != 1 || fetched["mem://lists/extra.txt"] != 1 {
+		t.Errorf("fetched %q", fetcher.Fetched())
+	}
+
+	if _, err := Compile(context.Background(), cfg, WithFetcher(fetcher)); err == nil {
+		t.Errorf("Compile() of a config with lists error = nil")
+	}
+}
@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"context"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/lock"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/**
+ * Fetches every source of the config and of its lists and the files they
+ * include, keeps their content in the store and returns the lockfile
+ * describing them.
+ * The includes are the ones of the platforms given WithPlatforms, a build
+ * from the lockfile with other platforms may need files that are not
+ * locked.
+ *
+ * A source that does not match its sha256 is an error, unless
+ * cfg.Integrity is config.INTEGRITY_WARN.
+ */
+func Lock(ctx context.Context, cfg Config, store lock.Store, opts ...Option) (lock.Lockfile, error) {
+	var o options = defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var lockfile lock.Lockfile = lock.Lockfile{Version: lock.VERSION, Created: o.clock().UTC().Truncate(time.Second)}
+	if err := cfg.Validate(); err != nil {
+		return lockfile, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var fetcher Fetcher = o.fetcher
+	if fetcher == nil {
+		var err error
+		if fetcher, err = httpFetcher(cfg.HTTP); err != nil {
+			return lockfile, err
+		}
+	}
+	var recorder *lock.Recorder = lock.NewRecorder(fetcher, store, o.clock)
+	var open func(source Source) preprocessor.Opener = sourceOpener(ctx, cfg.Limits, recorder, o)
+
+	for _, source := range cfg.AllSources() {
+		var pre *preprocessor.Preprocessor = preprocessor.New(o.platforms, open(source))
+		if err := pre.Process(source.Source, func(line string) {}); err != nil {
+			return lockfile, fmt.Errorf("unable to lock %s: %w", fetch.Redact(source.Source), err)
+		}
+
+		var locked lock.Source = lock.Source{Name: source.Name, Source: fetch.Redact(source.Source), Files: recorder.Take()}
+		if digest := locked.Files[0].SHA256; source.SHA256 != "" && !strings.EqualFold(source.SHA256, digest) {
+			if cfg.Integrity != config.INTEGRITY_WARN {
+				return lockfile, fmt.Errorf("%s does not match its sha256: expected %s, got %s", locked.Source, strings.ToLower(source.SHA256), digest)
+			}
+			o.logger.Warn("source does not match its sha256", "source", source.Name, "sha256", digest)
+		}
+
+		o.logger.Debug("locked", "source", source.Name, "files", len(locked.Files))
+		lockfile.Sources = append(lockfile.Sources, locked)
+	}
+	return lockfile, nil
+}
@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"context"
+	"dns-hostlist-compiler/modules/lock"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockedBuild(t *testing.T) {
+	var fetcher = testFetcher()
+	var store lock.Store = lock.NewStore(filepath.Join(t.TempDir(), "vendor"))
+	var cfg Config = Config{
+		Name:     "Locked",
+		Header:   true,
+		Checksum: true,
+		Sources:  []Source{{Name: "Ads", Source: "mem://lists/ads.txt"}},
+	}
+	var clock = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	lockfile, err := Lock(context.Background(), cfg, store, WithFetcher(fetcher), WithClock(clock), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []lock.File = lockfile.Sources[0].Files
+	if len(files) != 2 || files[0].Location != "mem://lists/ads.txt" || files[1].Location != "mem://lists/extra.txt" {
+		t.Fatalf("locked files = %+v", files)
+	}
+
+	locked, err := Compile(context.Background(), cfg, WithLockfile(lockfile, store), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream list moved on, the locked build does not
+	fetcher.Set("mem://lists/ads.txt", "||moved.example.org^\n")
+	again, err := Compile(context.Background(), cfg, WithLockfile(lockfile, store), WithLogger(quietLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Lines, locked.Lines) || !strings.Contains(strings.Join(locked.Lines, "\n"), "! TimeUpdated: 2024-05-01T12:00:00Z") {
+		t.Errorf("locked builds differ: %q and %q", locked.Lines, again.Lines)
+	}
+	if locked.Started.Equal(lockfile.Created) || !locked.Updated.Equal(lockfile.Created) {
+		t.Errorf("locked build started at %v, updated at %v, want the run time and the lock time", locked.Started, locked.Updated)
+	}
+	if len(fetcher.Fetched()) != 2 {
+		t.Errorf("the locked builds fetched %q", fetcher.Fetched()[2:])
+	}
+
+	cfg.Sources = append(cfg.Sources, Source{Name: "Empty", Source: "mem://lists/empty.txt"})
+	if _, err := Compile(context.Background(), cfg, WithLockfile(lockfile, store), WithLogger(quietLogger())); err == nil || !strings.Contains(err.Error(), "not in the lockfile") {
+		t.Errorf("Compile() of a source that is not locked error = %v", err)
+	}
+
+	cfg.Sources = []Source{{Name: "Ads", Source: "mem://lists/ads.txt", SHA256: files[1].SHA256}}
+	if _, err := Lock(context.Background(), cfg, store, WithFetcher(fetcher), WithLogger(quietLogger())); err == nil || !strings.Contains(err.Error(), "does not match its sha256") {
+		t.Errorf("Lock() of a source that does not match its sha256 error = %v", err)
+	}
+}
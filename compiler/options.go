@@ -0,0 +1,135 @@
+package compiler
+
+import (
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/format"
+	"dns-hostlist-compiler/modules/guard"
+	"dns-hostlist-compiler/modules/lock"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+/**
+ * Fetcher reads the content of a source, the URL or path given in the
+ * config and the files it includes. fetch.Registry picks a fetcher by
+ * URL scheme, fetch.Default with the http settings of the config is used
+ * unless WithFetcher is given.
+ */
+type (
+	Fetcher     = fetch.Fetcher
+	FetcherFunc = fetch.FetcherFunc
+)
+
+type options struct {
+	// Set by WithFetcher, the http settings of the config are not used then
+	fetcher   Fetcher
+	logger    *slog.Logger
+	clock     func() time.Time
+	platforms []string
+	format    string
+	// Set by WithLockfile
+	lockfile *lock.Lockfile
+	store    lock.Store
+	// Counts of the build the guards compare with
+	previous *guard.Counts
+	// Set by WithPreviousBuilds, by list name
+	previousLists map[string]guard.Counts
+	// Number of lists CompileLists builds at the same time
+	parallelism int
+	// Set by WithParsedSources, CompileLists keeps the shared sources
+	parsed *ParsedSources
+}
+
+func defaultOptions() options {
+	return options{
+		logger:      slog.Default(),
+		clock:       time.Now,
+		platforms:   preprocessor.DEFAULT_PLATFORMS,
+		format:      format.ADBLOCK,
+		parallelism: runtime.NumCPU(),
+	}
+}
+
+type Option func(o *options)
+
+func WithFetcher(fetcher Fetcher) Option {
+	return func(o *options) {
+		o.fetcher = fetcher
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// The clock gives the build time, written to the header unless WithLockfile is given
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// Platform constants the !#if directives are evaluated against
+func WithPlatforms(platforms ...string) Option {
+	return func(o *options) {
+		o.platforms = platforms
+	}
+}
+
+// Output syntax, one of format.FORMATS
+func WithFormat(outputFormat string) Option {
+	return func(o *options) {
+		o.format = outputFormat
+	}
+}
+
+/**
+ * Builds from the content locked by Lock instead of fetching the
+ * sources, the header has the time of the lock so the list is the same
+ * as the one built when locking. No credentials are read.
+ */
+func WithLockfile(lockfile lock.Lockfile, store lock.Store) Option {
+	return func(o *options) {
+		o.lockfile = &lockfile
+		o.store = store
+	}
+}
+
+/**
+ * The counts of the previous build, from Result.Counts or read back from
+ * the published list with guard.CountsFromLines. The maxChangePercent
+ * guards are only checked with a previous build.
+ */
+func WithPreviousBuild(counts GuardCounts) Option {
+	return func(o *options) {
+		o.previous = &counts
+	}
+}
+
+// The counts of the previous builds of the lists for CompileLists, by list name
+func WithPreviousBuilds(counts map[string]GuardCounts) Option {
+	return func(o *options) {
+		o.previousLists = counts
+	}
+}
+
+/**
+ * Takes the sources from the given ParsedSources when another build
+ * already read them, and keeps those this build reads there.
+ */
+func WithParsedSources(parsed *ParsedSources) Option {
+	return func(o *options) {
+		o.parsed = parsed
+	}
+}
+
+// Number of lists CompileLists builds at the same time, the number of CPUs by default
+func WithParallelism(n int) Option {
+	return func(o *options) {
+		o.parallelism = max(n, 1)
+	}
+}
@@ -1,20 +1,241 @@
 package cli
 
 import (
+	"dns-hostlist-compiler/modules/format"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
 )
 
-func ParseArgs() (string, string) {
-	input := flag.String("input", "list.txt", "path to input list of URLs/files")
-	output := flag.String("output", "outfile.txt", "path to output combined rules file")
-	flag.Parse()
+// Exit codes, these are part of the interface and must not change
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	EXIT_USAGE = 2
+)
+
+const PROGRAM_NAME = "dns-hostlist-compiler"
+
+/**
+ * Flags shared by every command. They can be given before or after the
+ * command name.
+ */
+type Globals struct {
+	Config    string
+	LogLevel  string
+	LogFormat string
+	Quiet     bool
+	CacheDir  string
+	Format    string
+	// Set up from the flags above before the command runs
+	Logger *slog.Logger
+}
+
+var LOG_FORMATS []string = []string{"text", "json"}
+
+type Command struct {
+	Name    string
+	Summary string
+	// Arguments after the flags, e.g. "<old> <new>"
+	Args string
+	// Defines the command flags and returns the function running the command
+	Setup func(fs *flag.FlagSet) func(globals Globals, args []string) error
+}
+
+/**
+ * UsageError is returned by a command when it was called with invalid
+ * arguments, the command help is printed and the exit code is EXIT_USAGE.
+ */
+type UsageError struct {
+	Message string
+}
+
+func (e UsageError) Error() string {
+	return e.Message
+}
+
+func Usagef(format string, a ...any) error {
+	return UsageError{Message: fmt.Sprintf(format, a...)}
+}
+
+/**
+ * ExitError makes the program exit with the given code,
+ * e.g. when a check ran fine but found problems.
+ */
+type ExitError struct {
+	Code    int
+	Message string
+}
 
-	if *input == "" {
-		fmt.Println("input cannot be empty")
-		flag.Usage()
-		return "list.txt", *output
+func (e ExitError) Error() string {
+	return e.Message
+}
+
+type CLI struct {
+	commands map[string]Command
+	stderr   io.Writer
+}
+
+func New(commands ...Command) *CLI {
+	var c *CLI = &CLI{commands: make(map[string]Command), stderr: os.Stderr}
+	for _, command := range commands {
+		c.commands[command.Name] = command
+	}
+	return c
+}
+
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
 	}
+	return dir + string(os.PathSeparator) + PROGRAM_NAME
+}
+
+func (g *Globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.Config, "config", g.Config, "path to a JSON config with the sources and list metadata")
+	fs.StringVar(&g.LogLevel, "log-level", g.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&g.LogFormat, "log-format", g.LogFormat, "log format: "+strings.Join(LOG_FORMATS, ", "))
+	fs.BoolVar(&g.Quiet, "quiet", g.Quiet, "only log errors and do not print progress")
+	fs.StringVar(&g.CacheDir, "cache-dir", g.CacheDir, "directory for cached sources and builds")
+	fs.StringVar(&g.Format, "format", g.Format, "output format: "+strings.Join(format.FORMATS, ", "))
+}
 
-	return *input, *output
+/**
+ * Checks the global flags and sets up the logger, logs go to w.
+ */
+func (g *Globals) setup(w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(g.LogLevel)); err != nil {
+		return Usagef("invalid --log-level %q", g.LogLevel)
+	}
+	if g.Quiet {
+		level = max(level, slog.LevelError)
+	}
+	if err := format.Validate(g.Format); err != nil {
+		return Usagef("invalid --format: %v", err)
+	}
+	if g.CacheDir == "" {
+		return Usagef("--cache-dir cannot be empty")
+	}
+
+	var options *slog.HandlerOptions = &slog.HandlerOptions{Level: level}
+	switch g.LogFormat {
+	case "text":
+		g.Logger = slog.New(slog.NewTextHandler(w, options))
+	case "json":
+		g.Logger = slog.New(slog.NewJSONHandler(w, options))
+	default:
+		return Usagef("invalid --log-format %q", g.LogFormat)
+	}
+	return nil
+}
+
+func (c *CLI) names() []string {
+	var names []string
+	for name := range c.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *CLI) usage(fs *flag.FlagSet) {
+	fmt.Fprintf(c.stderr, "Usage: %s [global flags] <command> [flags]\n\nCommands:\n", PROGRAM_NAME)
+	for _, name := range c.names() {
+		fmt.Fprintf(c.stderr, "  %-10s %s\n", name, c.commands[name].Summary)
+	}
+	fmt.Fprintf(c.stderr, "\nRun \"%s help <command>\" for the flags of a command.\n\nGlobal flags:\n", PROGRAM_NAME)
+	fs.PrintDefaults()
+}
+
+func (c *CLI) commandUsage(command Command, fs *flag.FlagSet) {
+	fmt.Fprintf(c.stderr, "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", PROGRAM_NAME, command.Name, command.Args, command.Summary)
+	fs.PrintDefaults()
+}
+
+/**
+ * Runs the command named by the first non-flag argument and returns the
+ * exit code.
+ */
+func (c *CLI) Run(args []string) int {
+	var globals Globals = Globals{LogLevel: "info", LogFormat: "text", CacheDir: DefaultCacheDir(), Format: format.ADBLOCK}
+
+	var top *flag.FlagSet = flag.NewFlagSet(PROGRAM_NAME, flag.ContinueOnError)
+	top.SetOutput(c.stderr)
+	globals.register(top)
+	top.Usage = func() { c.usage(top) }
+
+	if err := top.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+
+	if top.NArg() == 0 {
+		fmt.Fprintln(c.stderr, "no command given")
+		c.usage(top)
+		return EXIT_USAGE
+	}
+
+	var name string = top.Arg(0)
+	var rest []string = top.Args()[1:]
+	if name == "help" {
+		if len(rest) == 0 {
+			c.usage(top)
+			return EXIT_OK
+		}
+		name = rest[0]
+		rest = []string{"-h"}
+	}
+
+	command, exists := c.commands[name]
+	if !exists {
+		fmt.Fprintf(c.stderr, "unknown command %q, available commands: %s\n", name, strings.Join(c.names(), ", "))
+		return EXIT_USAGE
+	}
+
+	var fs *flag.FlagSet = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	globals.register(fs)
+	var run func(globals Globals, args []string) error = command.Setup(fs)
+	fs.Usage = func() { c.commandUsage(command, fs) }
+
+	if err := fs.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+
+	var err error = globals.setup(c.stderr)
+	if err == nil {
+		slog.SetDefault(globals.Logger)
+		err = run(globals, fs.Args())
+	}
+
+	var usageErr UsageError
+	var exitErr ExitError
+	switch {
+	case err == nil:
+		return EXIT_OK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(c.stderr, "%s: %s\n\n", name, usageErr.Message)
+		c.commandUsage(command, fs)
+		return EXIT_USAGE
+	case errors.As(err, &exitErr):
+		if exitErr.Message != "" {
+			fmt.Fprintf(c.stderr, "%s: %s\n", name, exitErr.Message)
+		}
+		return exitErr.Code
+	default:
+		fmt.Fprintf(c.stderr, "%s: %v\n", name, err)
+		return EXIT_ERROR
+	}
 }
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"testing"
+)
+
+func testCLI(got *Globals, gotArgs *[]string, err error) *CLI {
+	var c *CLI = New(Command{
+		Name:    "test",
+		Summary: "Test command.",
+		Setup: func(fs *flag.FlagSet) func(globals Globals, args []string) error {
+			fs.Bool("flag", false, "a command flag")
+			return func(globals Globals, args []string) error {
+				*got = globals
+				*gotArgs = args
+				return err
+			}
+		},
+	})
+	c.stderr = &bytes.Buffer{}
+	return c
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  error
+		want int
+	}{
+		{"ok", []string{"test"}, nil, EXIT_OK},
+		{"no command", nil, nil, EXIT_USAGE},
+		{"unknown command", []string{"bogus"}, nil, EXIT_USAGE},
+		{"unknown flag", []string{"test", "--bogus"}, nil, EXIT_USAGE},
+		{"invalid format", []string{"--format=bogus", "test"}, nil, EXIT_USAGE},
+		{"invalid log level", []string{"test", "--log-level=loud"}, nil, EXIT_USAGE},
+		{"invalid log format", []string{"--log-format=xml", "test"}, nil, EXIT_USAGE},
+		{"help", []string{"help", "test"}, nil, EXIT_OK},
+		{"usage error", []string{"test"}, Usagef("bad"), EXIT_USAGE},
+		{"error", []string{"test"}, errors.New("failed"), EXIT_ERROR},
+		{"exit error", []string{"test"}, ExitError{Code: 3}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var globals Globals
+			var args []string
+			if got := testCLI(&globals, &args, tt.err).Run(tt.args); got != tt.want {
+				t.Errorf("Run(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunGlobalFlags(t *testing.T) {
+	var globals Globals
+	var args []string
+	var c *CLI = testCLI(&globals, &args, nil)
+
+	if code := c.Run([]string{"--config=before.json", "test", "--format=hosts", "--flag", "arg"}); code != EXIT_OK {
+		t.Fatalf("Run() = %d", code)
+	}
+	if globals.Config != "before.json" || globals.Format != "hosts" || globals.LogLevel != "info" || globals.CacheDir == "" {
+		t.Errorf("globals = %+v", globals)
+	}
+	if len(args) != 1 || args[0] != "arg" {
+		t.Errorf("args = %q", args)
+	}
+}
+
+func TestRunQuiet(t *testing.T) {
+	var globals Globals
+	var args []string
+	if code := testCLI(&globals, &args, nil).Run([]string{"test", "--quiet", "--log-format=json"}); code != EXIT_OK {
+		t.Fatalf("Run() = %d", code)
+	}
+	if !globals.Quiet || globals.Logger == nil || globals.Logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.Errorf("--quiet logger still logs warnings: %+v", globals)
+	}
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/cache"
+	"flag"
+	"fmt"
+)
+
+func Cache() cli.Command {
+	return cli.Command{
+		Name:    "cache",
+		Summary: "Show the cache directory (path), list the cached files (list) or remove them (clear).",
+		Args:    "[path|list|clear]",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			return func(globals cli.Globals, args []string) error {
+				var action string = "list"
+				if len(args) > 1 {
+					return cli.Usagef("expected at most one action")
+				}
+				if len(args) == 1 {
+					action = args[0]
+				}
+
+				var c cache.Cache = cache.New(globals.CacheDir)
+				switch action {
+				case "path":
+					fmt.Println(c.Dir)
+				case "list":
+					entries, err := c.Entries()
+					if err != nil {
+						return err
+					}
+					for _, entry := range entries {
+						fmt.Printf("%-40s %10d  %s\n", entry.Path, entry.Size, entry.Modified.Format("2006-01-02 15:04:05"))
+					}
+				case "clear":
+					if err := c.Clear(); err != nil {
+						return err
+					}
+					fmt.Printf("Cleared %s\n", c.Dir)
+				default:
+					return cli.Usagef("unknown action %q", action)
+				}
+				return nil
+			}
+		},
+	}
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/app/io"
+	"dns-hostlist-compiler/modules/app/pipeline"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"fmt"
+	stdio "io"
+	"path/filepath"
+)
+
+const (
+	DEFAULT_INPUT  = "list.txt"
+	DEFAULT_OUTPUT = "outfile.txt"
+)
+
+func All() []cli.Command {
+	return []cli.Command{
+		Compile(),
+		Convert(),
+		Daemon(),
+		Diff(),
+		Explain(),
+		Lint(),
+		Lock(),
+		Serve(),
+		Stats(),
+		Cache(),
+	}
+}
+
+/**
+ * Loads the config given with --config, or makes one out of the links
+ * in the input file.
+ */
+func loadConfig(globals cli.Globals, input string) (config.Config, error) {
+	if globals.Config != "" {
+		return config.Load(globals.Config)
+	}
+
+	if input == "" {
+		return config.Config{}, cli.Usagef("either --config or --input is required")
+	}
+
+	links, err := io.ReadLinksFromFile(input)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("failed to read links: %w", err)
+	}
+	return config.Config{Sources: config.SourcesFromLinks(pipeline.DedupeSlice(links))}, nil
+}
+
+// Name the build is cached under: the list name, or the output file name
+func buildName(cfg config.Config, output string) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return filepath.Base(output)
+}
+
+// Reads a local file or URL into memory, line by line, with fetch.Default when open is nil
+func readLines(source string, open preprocessor.Opener) ([]string, error) {
+	if open == nil {
+		open = func(source string) (stdio.ReadCloser, error) {
+			return fetch.Default.Fetch(context.Background(), source)
+		}
+	}
+
+	body, err := open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading %s: %w", source, err)
+	}
+	return lines, nil
+}
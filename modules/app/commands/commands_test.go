@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/app/io"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		rule string
+		want []explanationStep
+	}{
+		{"! comment", []explanationStep{{"removecomments", "removed"}}},
+		{"0.0.0.0 a.org b.org", []explanationStep{
+			{"removecomments", "0.0.0.0 a.org b.org"},
+			{"compress", "||a.org^, ||b.org^"},
+			{"removemodifiers", "||a.org^, ||b.org^"},
+			{"validate", "||a.org^, ||b.org^"},
+		}},
+		{"||example.org^$script", []explanationStep{
+			{"removecomments", "||example.org^$script"},
+			{"compress", "||example.org^$script"},
+			{"removemodifiers", "||example.org^$script"},
+			{"validate", "removed"},
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := explain(tt.rule); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("explain(%q) = %+v, want %+v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func quietGlobals() cli.Globals {
+	return cli.Globals{Quiet: true, Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))}
+}
+
+func TestPreviousCountsFromOutputFile(t *testing.T) {
+	var fetcher *fetch.Memory = fetch.NewMemory(map[string]string{
+		"mem://ads.txt": "||ads.example.org^\n||sub.ads.example.org^\n0.0.0.0 tracker.example.net\n",
+	})
+	var dir string = t.TempDir()
+
+	for _, output := range []config.Output{
+		{Path: filepath.Join(dir, "list.txt.gz"), Gzip: true},
+		{Path: filepath.Join(dir, "hosts.txt"), Format: "hosts"},
+	} {
+		var cfg config.Config = config.Config{
+			Name:    "Ads",
+			Header:  true,
+			Sources: []config.Source{{Name: "Ads", Source: "mem://ads.txt"}},
+			Outputs: []config.Output{output},
+		}
+		result, err := compiler.Compile(context.Background(), cfg, compiler.WithFetcher(fetcher), compiler.WithLogger(quietGlobals().Logger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Cached elsewhere, the counts are read back from the output file
+		if err := publish(quietGlobals(), cache.New(t.TempDir()), cfg, result, io.WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		counts, found := previousCounts(cache.New(t.TempDir()), cfg)
+		if !found || !reflect.DeepEqual(counts, result.Counts()) {
+			t.Errorf("previousCounts() of %s = %+v, %v, want %+v", output.Path, counts, found, result.Counts())
+		}
+	}
+}
+
+func TestPublishKeepsOutputsOnBreach(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), "list.txt")
+	var cfg config.Config = config.Config{
+		Name:    "Ads",
+		Outputs: []config.Output{{Path: path}},
+	}
+	var result *compiler.Result = &compiler.Result{Breaches: []compiler.Breach{{Message: "1 rules, fewer than the minimum of 10"}}}
+
+	err := publish(quietGlobals(), cache.New(t.TempDir()), cfg, result, io.WriteOptions{})
+	var exitErr cli.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != cli.EXIT_ERROR || !strings.Contains(exitErr.Message, "previous outputs are kept") {
+		t.Errorf("publish() of a breaching build error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("publish() of a breaching build wrote %s", path)
+	}
+}
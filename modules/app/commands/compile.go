@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/app/io"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/guard"
+	"dns-hostlist-compiler/modules/lock"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func Compile() cli.Command {
+	return cli.Command{
+		Name:    "compile",
+		Summary: "Download the sources, compile them into one list, or every list of the config, and write the outputs.",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			input := fs.String("input", DEFAULT_INPUT, "path to input list of URLs/files, used when there is no --config")
+			output := fs.String("output", DEFAULT_OUTPUT, "path to output combined rules file, when the config has no outputs")
+			platforms := fs.String("platform", strings.Join(preprocessor.DEFAULT_PLATFORMS, ","), "comma-separated platform constants for !#if directives")
+			withHeader := fs.Bool("header", false, "write the metadata header at the top of the output")
+			withChecksum := fs.Bool("checksum", false, "add a checksum line to the header")
+			integrity := fs.String("integrity", "", "what a source not matching its sha256 does, fail or warn (default from the config, fail)")
+			locked := fs.Bool("locked", false, "build from the content recorded by the lock command, without fetching anything")
+			lockfilePath := fs.String("lockfile", lock.DEFAULT_LOCKFILE, "lockfile used with --locked")
+			compressed := fs.Bool("gzip", false, "write the output gzip-compressed")
+			backups := fs.Int("backups", 0, "number of previous versions of the output to keep as <output>.1 to <output>.N")
+			mode := fs.String("mode", "", "octal permissions of the output file, e.g. 0644 (default: those of the file being replaced, or 0644)")
+			runReport := fs.String("run-report", "", "path to write a JSON report with the per-source and per-stage metrics")
+			jobs := fs.Int("jobs", runtime.NumCPU(), "number of lists of the config compiled at the same time")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) > 0 {
+					return cli.Usagef("unexpected arguments: %s", strings.Join(args, " "))
+				}
+				if *output == "" {
+					return cli.Usagef("--output cannot be empty")
+				}
+				if *backups < 0 {
+					return cli.Usagef("--backups cannot be negative")
+				}
+				if *jobs < 1 {
+					return cli.Usagef("--jobs must be at least 1")
+				}
+				var writeOptions io.WriteOptions = io.WriteOptions{Backups: *backups}
+				if *mode != "" {
+					perm, err := strconv.ParseUint(*mode, 8, 32)
+					if err != nil || perm > 0o777 || perm == 0 {
+						return cli.Usagef("invalid --mode %q, expected octal permissions such as 0644", *mode)
+					}
+					writeOptions.Mode = os.FileMode(perm)
+				}
+
+				cfg, err := loadConfig(globals, *input)
+				if err != nil {
+					return err
+				}
+				cfg.Header = cfg.Header || *withHeader
+				cfg.Checksum = cfg.Checksum || *withChecksum
+				if len(cfg.Outputs) > 0 || len(cfg.Lists) > 0 {
+					if isSet(fs, "output") || isSet(fs, "gzip") {
+						return cli.Usagef("--output and --gzip cannot be used with the outputs of the config")
+					}
+				} else {
+					cfg.Outputs = []config.Output{{Path: *output, Format: globals.Format, Gzip: *compressed}}
+				}
+				if len(cfg.Lists) > 0 && *runReport != "" {
+					return cli.Usagef("--run-report cannot be used with the lists of the config")
+				}
+				if *integrity != "" {
+					if *integrity != compiler.INTEGRITY_FAIL && *integrity != compiler.INTEGRITY_WARN {
+						return cli.Usagef("--integrity must be %s or %s", compiler.INTEGRITY_FAIL, compiler.INTEGRITY_WARN)
+					}
+					cfg.Integrity = *integrity
+				}
+
+				var opts []compiler.Option = []compiler.Option{
+					compiler.WithLogger(globals.Logger),
+					compiler.WithPlatforms(strings.Split(*platforms, ",")...),
+					compiler.WithFormat(globals.Format),
+					compiler.WithParallelism(*jobs),
+				}
+				if *locked {
+					lockfile, store, err := loadLockfile(globals, *lockfilePath)
+					if err != nil {
+						return err
+					}
+					opts = append(opts, compiler.WithLockfile(lockfile, store))
+				}
+
+				var c cache.Cache = cache.New(globals.CacheDir)
+				if len(cfg.Lists) > 0 {
+					return compileLists(globals, c, cfg, opts, writeOptions)
+				}
+
+				if previous, found := previousCounts(c, cfg); found {
+					opts = append(opts, compiler.WithPreviousBuild(previous))
+				}
+				result, err := compiler.Compile(context.Background(), cfg, opts...)
+				if err != nil {
+					return fmt.Errorf("pipeline error: %w", err)
+				}
+				// The report of a build breaching its guards is written too
+				var published error = publish(globals, c, cfg, result, writeOptions)
+
+				if *runReport != "" {
+					if err := result.Report().Write(*runReport); err != nil {
+						return fmt.Errorf("failed to write the run report: %w", err)
+					}
+				}
+				return published
+			}
+		},
+	}
+}
+
+/**
+ * Compiles the lists of the config and publishes those that were built,
+ * a list that failed leaves its previous outputs in place and fails the
+ * command once the others are written.
+ */
+func compileLists(globals cli.Globals, c cache.Cache, cfg config.Config, opts []compiler.Option, writeOptions io.WriteOptions) error {
+	var previous map[string]compiler.GuardCounts = make(map[string]compiler.GuardCounts)
+	for _, listCfg := range cfg.ListConfigs() {
+		if counts, found := previousCounts(c, listCfg); found {
+			previous[listCfg.Name] = counts
+		}
+	}
+
+	results, err := compiler.CompileLists(context.Background(), cfg, append(opts, compiler.WithPreviousBuilds(previous))...)
+	if err != nil {
+		return fmt.Errorf("pipeline error: %w", err)
+	}
+
+	var failed []string
+	for _, list := range results {
+		if list.Err == nil {
+			list.Err = publish(globals, c, list.Config, list.Result, writeOptions)
+		}
+		if list.Err != nil {
+			globals.Logger.Error("the list was not built", "list", list.Config.Name, "error", list.Err)
+			failed = append(failed, list.Config.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d lists failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+/**
+ * Writes the outputs of a build and caches it for diff and the guards.
+ * A build that breached its guards leaves the previous outputs in place
+ * and fails with the breaches, so that a scheduled run notices it.
+ */
+func publish(globals cli.Globals, c cache.Cache, cfg config.Config, result *compiler.Result, writeOptions io.WriteOptions) error {
+	if len(result.Breaches) > 0 {
+		var breached error = &compiler.GuardError{Breaches: result.Breaches}
+		return cli.ExitError{Code: cli.EXIT_ERROR, Message: fmt.Sprintf("%s, the previous outputs are kept", breached)}
+	}
+
+	for _, rendered := range result.Outputs {
+		writeOptions.Gzip = rendered.Gzip
+		if err := io.WriteFile(rendered.Path, rendered.Lines, writeOptions); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if !globals.Quiet {
+			fmt.Printf("Wrote %d rules to %s\n", len(rendered.Rules), rendered.Path)
+		}
+	}
+
+	// The first output is the one cached, the next build is compared with it
+	var name string = buildName(cfg, cfg.Outputs[0].Path)
+	if err := c.SaveBuild(name, result.Outputs[0].Lines); err != nil {
+		globals.Logger.Warn("unable to cache the build", "error", err)
+	}
+	if err := c.SaveBuildStats(name, result.Counts()); err != nil {
+		globals.Logger.Warn("unable to cache the rule counts", "error", err)
+	}
+	return nil
+}
+
+/**
+ * Counts of the last published build for the guards: from the cache, or
+ * read back from the first output file when it was built elsewhere. The
+ * file is decompressed when it is gzip-compressed, and its rules are the
+ * lines that are not comments, as Result.Counts counts them.
+ */
+func previousCounts(c cache.Cache, cfg config.Config) (compiler.GuardCounts, bool) {
+	var counts compiler.GuardCounts
+	if err := c.LoadBuildStats(buildName(cfg, cfg.Outputs[0].Path), &counts); err == nil {
+		return counts, true
+	}
+
+	lines, err := readLines(cfg.Outputs[0].Path, nil)
+	if err != nil {
+		return counts, false
+	}
+	return guard.CountsFromLines(lines), true
+}
+
+// Whether the flag was given on the command line
+func isSet(fs *flag.FlagSet, name string) bool {
+	var set bool = false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/format"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func Convert() cli.Command {
+	return cli.Command{
+		Name:    "convert",
+		Summary: "Convert a list between the adblock-style and hosts syntax, the output format is set with --format.",
+		Args:    "<file or URL>",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			output := fs.String("output", "", "path to the converted list, stdout when empty")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) != 1 {
+					return cli.Usagef("expected exactly one list to convert")
+				}
+
+				body, err := fetch.Default.Fetch(context.Background(), args[0])
+				if err != nil {
+					return err
+				}
+				defer body.Close()
+
+				var out io.Writer = os.Stdout
+				if *output != "" {
+					f, err := os.Create(*output)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					out = f
+				}
+
+				w := bufio.NewWriter(out)
+				var converted, dropped int
+				scanner := bufio.NewScanner(body)
+				scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+				for scanner.Scan() {
+					lines, n := format.Render([]string{scanner.Text()}, globals.Format)
+					dropped += n
+					for _, line := range lines {
+						converted += 1
+						if _, err := fmt.Fprintln(w, line); err != nil {
+							return err
+						}
+					}
+				}
+				if err := scanner.Err(); err != nil {
+					return fmt.Errorf("error while reading %s: %w", args[0], err)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+
+				if dropped > 0 {
+					globals.Logger.Warn("rules cannot be written in the output format", "format", globals.Format, "dropped", dropped)
+				}
+				globals.Logger.Info("converted", "source", args[0], "format", globals.Format, "lines", converted)
+				return nil
+			}
+		},
+	}
+}
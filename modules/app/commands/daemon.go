@@ -0,0 +1,310 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/app/io"
+	"dns-hostlist-compiler/modules/app/pipeline"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/schedule"
+	"flag"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func Daemon() cli.Command {
+	return cli.Command{
+		Name:    "daemon",
+		Summary: "Keep running and rebuild every list of the config on its own schedule.",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			input := fs.String("input", DEFAULT_INPUT, "path to input list of URLs/files, used when there is no --config")
+			output := fs.String("output", DEFAULT_OUTPUT, "path to output combined rules file, when the config has no outputs")
+			defaultSchedule := fs.String("schedule", "@every 1h", "cron expression or interval of the lists without a schedule in the config")
+			platforms := fs.String("platform", strings.Join(preprocessor.DEFAULT_PLATFORMS, ","), "comma-separated platform constants for !#if directives")
+			jobs := fs.Int("jobs", runtime.NumCPU(), "number of lists built at the same time")
+			backups := fs.Int("backups", 0, "number of previous versions of the outputs to keep as <output>.1 to <output>.N")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) > 0 {
+					return cli.Usagef("unexpected arguments: %s", strings.Join(args, " "))
+				}
+				if _, err := schedule.Parse(*defaultSchedule); err != nil {
+					return cli.Usagef("--schedule: %s", err)
+				}
+				if *jobs < 1 {
+					return cli.Usagef("--jobs must be at least 1")
+				}
+				if *backups < 0 {
+					return cli.Usagef("--backups cannot be negative")
+				}
+
+				var d *daemon = &daemon{
+					globals:         globals,
+					cache:           cache.New(globals.CacheDir),
+					input:           *input,
+					output:          *output,
+					defaultSchedule: *defaultSchedule,
+					writeOptions:    io.WriteOptions{Backups: *backups},
+					slots:           make(chan struct{}, *jobs),
+					lists:           make(map[string]*daemonList),
+					clock:           time.Now,
+					timer:           newTimer,
+					newFetcher:      compiler.NewFetcher,
+					opts: []compiler.Option{
+						compiler.WithLogger(globals.Logger),
+						compiler.WithPlatforms(strings.Split(*platforms, ",")...),
+						compiler.WithFormat(globals.Format),
+					},
+				}
+				if err := d.load(); err != nil {
+					return err
+				}
+
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				var reload chan os.Signal = make(chan os.Signal, 1)
+				signal.Notify(reload, syscall.SIGHUP)
+				defer signal.Stop(reload)
+
+				d.run(ctx, reload)
+				return nil
+			}
+		},
+	}
+}
+
+// A list of the config and the state of its builds
+type daemonList struct {
+	cfg      config.Config
+	schedule schedule.Schedule
+	next     time.Time
+	running  bool
+	// Files of the last build, revalidated before the next one
+	files    []fetch.Request
+	previous *compiler.GuardCounts
+	// The sources read by the builds, those that did not change are not
+	// read again
+	parsed *pipeline.ParsedSources
+}
+
+// What a build of a list left for the next one
+type daemonBuild struct {
+	name        string
+	conditional *fetch.Conditional
+	files       []fetch.Request
+	counts      *compiler.GuardCounts
+}
+
+type daemon struct {
+	globals         cli.Globals
+	cache           cache.Cache
+	input           string
+	output          string
+	defaultSchedule string
+	opts            []compiler.Option
+	writeOptions    io.WriteOptions
+	// Limits the builds running at the same time
+	slots chan struct{}
+	// time.Now, newTimer and compiler.NewFetcher outside of the tests
+	clock      func() time.Time
+	timer      func(d time.Duration) (<-chan time.Time, func() bool)
+	newFetcher func(cfg config.Config) (compiler.Fetcher, error)
+	// Set from the config by load
+	fetcher     compiler.Fetcher
+	conditional *fetch.Conditional
+	lists       map[string]*daemonList
+}
+
+/**
+ * Loads the config and schedules every list to be built now. The counts
+ * of the previous builds of the lists are kept, their files are fetched
+ * again since the config may have changed.
+ */
+func (d *daemon) load() error {
+	cfg, err := loadConfig(d.globals, d.input)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Outputs) == 0 && len(cfg.Lists) == 0 {
+		cfg.Outputs = []config.Output{{Path: d.output, Format: d.globals.Format}}
+	}
+	var configs []config.Config = []config.Config{cfg}
+	if len(cfg.Lists) > 0 {
+		configs = cfg.ListConfigs()
+	}
+
+	fetcher, err := d.newFetcher(cfg)
+	if err != nil {
+		return err
+	}
+
+	var lists map[string]*daemonList = make(map[string]*daemonList)
+	var now time.Time = d.clock()
+	for _, listCfg := range configs {
+		var spec string = listCfg.Schedule
+		if spec == "" {
+			spec = d.defaultSchedule
+		}
+		listSchedule, err := schedule.Parse(spec)
+		if err != nil {
+			return err
+		}
+
+		var name string = listName(listCfg)
+		var list *daemonList = &daemonList{cfg: listCfg, schedule: listSchedule, next: now, parsed: pipeline.NewParsedSources(nil)}
+		if previous, found := d.lists[name]; found {
+			list.previous = previous.previous
+			list.running = previous.running
+		} else if counts, found := previousCounts(d.cache, listCfg); found {
+			list.previous = &counts
+		}
+		lists[name] = list
+	}
+
+	d.fetcher = fetcher
+	d.conditional = fetch.NewConditional()
+	d.lists = lists
+	return nil
+}
+
+/**
+ * Starts the lists that are due and waits for the next one, a reload or
+ * a build to finish. Once the context is done the running builds are
+ * canceled and waited for.
+ */
+func (d *daemon) run(ctx context.Context, reload chan os.Signal) {
+	var finished chan daemonBuild = make(chan daemonBuild)
+	var wg sync.WaitGroup
+	d.globals.Logger.Info("daemon started", "lists", len(d.lists))
+
+	for {
+		var now time.Time = d.clock()
+		var wake time.Time = now.Add(24 * time.Hour)
+		for name, list := range d.lists {
+			if !list.running && !now.Before(list.next) {
+				list.running = true
+				list.next = list.schedule.Next(now)
+				wg.Add(1)
+				go func(name string, list daemonList, conditional *fetch.Conditional, fetcher compiler.Fetcher) {
+					defer wg.Done()
+					finished <- d.build(ctx, name, list, conditional, fetcher)
+				}(name, *list, d.conditional, d.fetcher)
+			}
+			if !list.running && !list.next.IsZero() && list.next.Before(wake) {
+				wake = list.next
+			}
+		}
+
+		timer, stopTimer := d.timer(wake.Sub(now))
+		select {
+		case <-ctx.Done():
+			stopTimer()
+			d.globals.Logger.Info("shutting down, waiting for the running builds")
+			var done chan struct{} = make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			for {
+				select {
+				case <-finished:
+				case <-done:
+					return
+				}
+			}
+		case <-reload:
+			if err := d.load(); err != nil {
+				d.globals.Logger.Error("unable to reload the config, the previous one is kept", "error", err)
+			} else {
+				d.globals.Logger.Info("config reloaded", "lists", len(d.lists))
+			}
+		case build := <-finished:
+			if list, found := d.lists[build.name]; found {
+				list.running = false
+				// Files revalidated against another config are fetched again
+				if build.conditional == d.conditional {
+					list.files = build.files
+				}
+				if build.counts != nil {
+					list.previous = build.counts
+				}
+			}
+		case <-timer:
+		}
+		stopTimer()
+	}
+}
+
+// A timer firing after d and the function stopping it
+func newTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	var timer *time.Timer = time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+/**
+ * Builds a list and writes its outputs. The files of its previous build
+ * are revalidated first, when none of them changed the list is not
+ * compiled again. Otherwise only the sources reading the files that
+ * changed are read again, the others are taken from the previous builds.
+ */
+func (d *daemon) build(ctx context.Context, name string, list daemonList, conditional *fetch.Conditional, fetcher compiler.Fetcher) daemonBuild {
+	var build daemonBuild = daemonBuild{name: name, conditional: conditional}
+	select {
+	case d.slots <- struct{}{}:
+		defer func() { <-d.slots }()
+	case <-ctx.Done():
+		return build
+	}
+
+	var round *fetch.Round = conditional.Round(fetcher)
+	changed, err := round.Revalidate(ctx, list.files)
+	switch {
+	case err != nil || len(list.files) == 0:
+		// The sources kept may be those of a build that was not written
+		list.parsed.Clear()
+	case len(changed) == 0:
+		d.globals.Logger.Info("the sources did not change, the build is skipped", "list", name, "next", list.next)
+		build.files = list.files
+		return build
+	default:
+		var files []string
+		for _, request := range changed {
+			files = append(files, request.Source)
+		}
+		list.parsed.Forget(files)
+	}
+
+	var opts []compiler.Option = append(append([]compiler.Option{}, d.opts...), compiler.WithFetcher(round), compiler.WithParsedSources(list.parsed))
+	if list.previous != nil {
+		opts = append(opts, compiler.WithPreviousBuild(*list.previous))
+	}
+	result, err := compiler.Compile(ctx, list.cfg, opts...)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.globals.Logger.Error("the list was not built", "list", name, "error", err)
+		}
+		return build
+	}
+	if err := publish(d.globals, d.cache, list.cfg, result, d.writeOptions); err != nil {
+		d.globals.Logger.Error("the list was not written", "list", name, "error", err)
+		return build
+	}
+
+	// A build breaching its guards is not the one the next is compared with
+	if len(result.Breaches) == 0 {
+		var counts compiler.GuardCounts = result.Counts()
+		build.counts = &counts
+		build.files = round.Fetched()
+	}
+	d.globals.Logger.Info("list built", "list", name, "rules", len(result.Rules), "next", list.next)
+	return build
+}
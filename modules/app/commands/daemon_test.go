@@ -0,0 +1,346 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/io"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"encoding/json"
+	stdio "io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Clock of the daemon, moved forward by the test
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Passes every file fetched to the test and waits for it to be released
+type gatedFetcher struct {
+	next    *fetch.Memory
+	fetches chan string
+	release chan struct{}
+}
+
+func (f *gatedFetcher) Fetch(ctx context.Context, source string) (stdio.ReadCloser, error) {
+	select {
+	case f.fetches <- source:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return f.next.Fetch(ctx, source)
+}
+
+func (f *gatedFetcher) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case source := <-f.fetches:
+		if source != want {
+			t.Fatalf("fetched %s, want %s", source, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not fetched", want)
+	}
+}
+
+func writeDaemonConfig(t *testing.T, path string, source string, output string) {
+	t.Helper()
+	data, err := json.Marshal(config.Config{
+		Name:     "Ads",
+		Schedule: "@every 1h",
+		Sources:  []config.Source{{Name: "Ads", Source: source}},
+		Outputs:  []config.Output{{Path: output}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	var dir string = t.TempDir()
+	var configPath string = filepath.Join(dir, "config.json")
+	var output string = filepath.Join(dir, "list.txt")
+	writeDaemonConfig(t, configPath, "mem://ads.txt", output)
+
+	var fetcher *gatedFetcher = &gatedFetcher{
+		next: fetch.NewMemory(map[string]string{
+			"mem://ads.txt":   "||ads.example.org^\n",
+			"mem://other.txt": "||other.example.org^\n",
+		}),
+		fetches: make(chan string),
+		release: make(chan struct{}),
+	}
+	var clock *fakeClock = &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	var tick chan time.Time = make(chan time.Time)
+	var globals = quietGlobals()
+	globals.Config = configPath
+
+	var d *daemon = &daemon{
+		globals:      globals,
+		cache:        cache.New(filepath.Join(dir, "cache")),
+		writeOptions: io.WriteOptions{},
+		slots:        make(chan struct{}, 2),
+		lists:        make(map[string]*daemonList),
+		clock:        clock.Now,
+		timer: func(d time.Duration) (<-chan time.Time, func() bool) {
+			return tick, func() bool { return true }
+		},
+		newFetcher: func(cfg config.Config) (compiler.Fetcher, error) {
+			return fetcher, nil
+		},
+		opts: []compiler.Option{compiler.WithLogger(globals.Logger)},
+	}
+	if err := d.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reload chan os.Signal = make(chan os.Signal)
+	var stopped chan struct{} = make(chan struct{})
+	go func() {
+		d.run(ctx, reload)
+		close(stopped)
+	}()
+
+	// Built at start
+	fetcher.expect(t, "mem://ads.txt")
+	fetcher.release <- struct{}{}
+
+	// Revalidated an hour later, nothing changed so the build is skipped
+	tick <- clock.Add(time.Hour)
+	fetcher.expect(t, "mem://ads.txt")
+	fetcher.release <- struct{}{}
+
+	tick <- clock.Add(time.Hour)
+	fetcher.expect(t, "mem://ads.txt")
+	if _, err := d.cache.LoadPreviousBuild("Ads"); err == nil {
+		t.Errorf("the unchanged list was built again")
+	}
+	fetcher.next.Set("mem://ads.txt", "||changed.example.org^\n")
+
+	// A reload while the list is being built waits for that build
+	writeDaemonConfig(t, configPath, "mem://other.txt", output)
+	reload <- syscall.SIGHUP
+	select {
+	case source := <-fetcher.fetches:
+		t.Fatalf("fetched %s while the list was still being built", source)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fetcher.release <- struct{}{}
+	fetcher.expect(t, "mem://other.txt")
+	if lines, err := readLines(output, nil); err != nil || strings.Join(lines, "\n") != "||changed.example.org^" {
+		t.Errorf("output = %q, %v, want the build running during the reload", lines, err)
+	}
+
+	// The shutdown cancels the running build and waits for it
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon did not stop")
+	}
+	if lines, err := readLines(output, nil); err != nil || strings.Join(lines, "\n") != "||changed.example.org^" {
+		t.Errorf("output after the shutdown = %q, %v", lines, err)
+	}
+}
+
+// Starts a daemon building the config with the fetcher, stopped at the end of the test
+func startDaemon(t *testing.T, cfg config.Config, fetcher compiler.Fetcher, clock *fakeClock, tick chan time.Time, logger *slog.Logger) {
+	t.Helper()
+	var dir string = t.TempDir()
+	var configPath string = filepath.Join(dir, "config.json")
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var globals = quietGlobals()
+	globals.Config = configPath
+	var d *daemon = &daemon{
+		globals:      globals,
+		cache:        cache.New(filepath.Join(dir, "cache")),
+		writeOptions: io.WriteOptions{},
+		slots:        make(chan struct{}, 2),
+		lists:        make(map[string]*daemonList),
+		clock:        clock.Now,
+		timer: func(d time.Duration) (<-chan time.Time, func() bool) {
+			return tick, func() bool { return true }
+		},
+		newFetcher: func(cfg config.Config) (compiler.Fetcher, error) {
+			return fetcher, nil
+		},
+		opts: []compiler.Option{compiler.WithLogger(logger)},
+	}
+	if err := d.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stopped chan struct{} = make(chan struct{})
+	go func() {
+		d.run(ctx, make(chan os.Signal))
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func TestDaemonSharedSource(t *testing.T) {
+	var dir string = t.TempDir()
+	var outputs []string = []string{filepath.Join(dir, "ads.txt"), filepath.Join(dir, "more.txt")}
+	var fetcher *gatedFetcher = &gatedFetcher{
+		next:    fetch.NewMemory(map[string]string{"mem://ads.txt": "||ads.example.org^\n"}),
+		fetches: make(chan string),
+		release: make(chan struct{}),
+	}
+	var clock *fakeClock = &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	var tick chan time.Time = make(chan time.Time)
+	startDaemon(t, config.Config{
+		Name:     "Ads",
+		Schedule: "@every 1h",
+		Sources:  []config.Source{{Name: "Ads", Source: "mem://ads.txt"}},
+		Lists: []config.List{
+			{Name: "Ads", Sources: []config.Source{{Name: "Ads"}}, Outputs: []config.Output{{Path: outputs[0]}}},
+			{Name: "More", Sources: []config.Source{{Name: "Ads"}}, Outputs: []config.Output{{Path: outputs[1]}}},
+		},
+	}, fetcher, clock, tick, quietGlobals().Logger)
+
+	// Every list fetches the source in its own round
+	for i := 0; i < 2; i += 1 {
+		fetcher.expect(t, "mem://ads.txt")
+		fetcher.release <- struct{}{}
+	}
+	waitOutputs(t, outputs, "||ads.example.org^")
+
+	// The list revalidating the changed source last rebuilds as well
+	fetcher.next.Set("mem://ads.txt", "||changed.example.org^\n")
+	tick <- clock.Add(time.Hour)
+	for i := 0; i < 2; i += 1 {
+		fetcher.expect(t, "mem://ads.txt")
+		fetcher.release <- struct{}{}
+	}
+	waitOutputs(t, outputs, "||changed.example.org^")
+}
+
+// Keeps what the logger writes, for the test to read while the daemon runs
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+// The lines logged with the message and the attribute
+func (b *lockedBuffer) count(msg string, attribute string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var n int
+	for _, line := range strings.Split(b.buffer.String(), "\n") {
+		if strings.Contains(line, " msg="+msg+" ") && strings.Contains(line, " "+attribute) {
+			n += 1
+		}
+	}
+	return n
+}
+
+func TestDaemonUnchangedSources(t *testing.T) {
+	var output string = filepath.Join(t.TempDir(), "list.txt")
+	var fetcher *gatedFetcher = &gatedFetcher{
+		next: fetch.NewMemory(map[string]string{
+			"mem://ads.txt":     "||ads.example.org^\n",
+			"mem://tracker.txt": "||tracker.example.org^\n",
+		}),
+		fetches: make(chan string),
+		release: make(chan struct{}),
+	}
+	var clock *fakeClock = &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	var tick chan time.Time = make(chan time.Time)
+	var logs *lockedBuffer = &lockedBuffer{}
+	startDaemon(t, config.Config{
+		Name:     "Ads",
+		Schedule: "@every 1h",
+		Sources:  []config.Source{{Name: "Ads", Source: "mem://ads.txt"}, {Name: "Tracker", Source: "mem://tracker.txt"}},
+		Outputs:  []config.Output{{Path: output}},
+	}, fetcher, clock, tick, slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	for _, source := range []string{"mem://ads.txt", "mem://tracker.txt"} {
+		fetcher.expect(t, source)
+		fetcher.release <- struct{}{}
+	}
+	waitOutputs(t, []string{output}, "||ads.example.org^\n||tracker.example.org^")
+
+	// Only the source that changed is read by the build
+	fetcher.next.Set("mem://ads.txt", "||changed.example.org^\n")
+	tick <- clock.Add(time.Hour)
+	for _, source := range []string{"mem://ads.txt", "mem://tracker.txt"} {
+		fetcher.expect(t, source)
+		fetcher.release <- struct{}{}
+	}
+	waitOutputs(t, []string{output}, "||changed.example.org^\n||tracker.example.org^")
+	if opened := logs.count("fetch", "url=mem://ads.txt"); opened != 2 {
+		t.Errorf("the changed source was read %d times, want 2", opened)
+	}
+	if opened := logs.count("fetch", "url=mem://tracker.txt"); opened != 1 {
+		t.Errorf("the unchanged source was read %d times, want 1", opened)
+	}
+}
+
+// Waits for the outputs to hold the rules
+func waitOutputs(t *testing.T, outputs []string, want string) {
+	t.Helper()
+	var deadline time.Time = time.Now().Add(5 * time.Second)
+	for _, output := range outputs {
+		for {
+			lines, err := readLines(output, nil)
+			if err == nil && strings.Join(lines, "\n") == want {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s = %q, %v, want %q", output, lines, err, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/diff"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func Diff() cli.Command {
+	return cli.Command{
+		Name:    "diff",
+		Summary: "Compare two lists, or the previous and latest cached builds with --previous.",
+		Args:    "<old> <new>",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			previous := fs.Bool("previous", false, "compare the previous and latest cached builds instead of two files")
+			name := fs.String("name", "", "name of the cached build or of a list of the config, defaults to the name in --config or the output file")
+			report := fs.String("report", "text", "report format: text or json")
+			exitCode := fs.Bool("exit-code", false, "exit with 1 when the lists differ")
+
+			return func(globals cli.Globals, args []string) error {
+				if *report != "text" && *report != "json" {
+					return cli.Usagef("invalid --report %q", *report)
+				}
+
+				var oldLines, newLines []string
+				var err error
+				if *previous {
+					if len(args) != 0 {
+						return cli.Usagef("--previous does not take files")
+					}
+					oldLines, newLines, err = cachedBuilds(globals, *name)
+				} else {
+					if len(args) != 2 {
+						return cli.Usagef("expected two lists to compare")
+					}
+					if oldLines, err = readLines(args[0], nil); err == nil {
+						newLines, err = readLines(args[1], nil)
+					}
+				}
+				if err != nil {
+					return err
+				}
+
+				var result diff.Result = diff.Diff(oldLines, newLines)
+				if *report == "json" {
+					encoder := json.NewEncoder(os.Stdout)
+					encoder.SetIndent("", "  ")
+					if err := encoder.Encode(result); err != nil {
+						return err
+					}
+				} else {
+					for _, rule := range result.Removed {
+						fmt.Printf("- %s\n", rule)
+					}
+					for _, rule := range result.Added {
+						fmt.Printf("+ %s\n", rule)
+					}
+					fmt.Printf("%d rules added, %d removed, %d hostnames newly covered, %d no longer covered\n",
+						len(result.Added), len(result.Removed), len(result.Covered), len(result.Uncovered))
+				}
+
+				if *exitCode && !result.Empty() {
+					return cli.ExitError{Code: cli.EXIT_ERROR}
+				}
+				return nil
+			}
+		},
+	}
+}
+
+func cachedBuilds(globals cli.Globals, name string) ([]string, []string, error) {
+	if name == "" {
+		var cfg config.Config
+		if globals.Config != "" {
+			var err error
+			if cfg, err = config.Load(globals.Config); err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(cfg.Lists) > 0 {
+			return nil, nil, cli.Usagef("the config has several lists, give the one to compare with --name")
+		}
+		var output string = DEFAULT_OUTPUT
+		if len(cfg.Outputs) > 0 {
+			output = cfg.Outputs[0].Path
+		}
+		name = buildName(cfg, output)
+	}
+
+	var c cache.Cache = cache.New(globals.CacheDir)
+	oldLines, err := c.LoadPreviousBuild(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no previous build of %s: %w", name, err)
+	}
+	newLines, err := c.LoadBuild(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no build of %s: %w", name, err)
+	}
+	return oldLines, newLines, nil
+}
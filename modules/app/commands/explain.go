@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/app/pipeline"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+func Explain() cli.Command {
+	return cli.Command{
+		Name:    "explain",
+		Summary: "Show what every transformation does to the given rules.",
+		Args:    "<rule>...",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			return func(globals cli.Globals, args []string) error {
+				if len(args) == 0 {
+					return cli.Usagef("expected at least one rule to explain")
+				}
+
+				for _, rule := range args {
+					fmt.Println(rule)
+					for _, step := range explain(rule) {
+						fmt.Printf("  %-16s %s\n", step.stage, step.result)
+					}
+				}
+				return nil
+			}
+		},
+	}
+}
+
+type explanationStep struct {
+	stage  string
+	result string
+}
+
+/**
+ * Runs a single rule through fresh pipeline stages and records the rules
+ * each stage passes on.
+ */
+func explain(rule string) []explanationStep {
+	var steps []explanationStep
+	var rules []string = []string{rule}
+
+	for _, stage := range pipeline.NewStages() {
+		var out []string = append([]string{}, stage.Process(rules)...)
+		out = append(out, stage.Flush()...)
+		rules = out
+
+		if len(rules) == 0 {
+			steps = append(steps, explanationStep{stage: stage.Name(), result: "removed"})
+			return steps
+		}
+		steps = append(steps, explanationStep{stage: stage.Name(), result: strings.Join(rules, ", ")})
+	}
+
+	return steps
+}
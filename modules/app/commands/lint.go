@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/lint"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+func Lint() cli.Command {
+	return cli.Command{
+		Name:    "lint",
+		Summary: "Check filter lists for rules the compiler would drop, duplicates and redundant rules.",
+		Args:    "[file...]",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			report := fs.String("report", lint.TEXT, "report format: "+strings.Join(lint.REPORT_FORMATS, ", "))
+
+			return func(globals cli.Globals, args []string) error {
+				if !slices.Contains(lint.REPORT_FORMATS, *report) {
+					return cli.Usagef("invalid --report %q", *report)
+				}
+
+				var files []lint.File
+				for _, path := range args {
+					lines, err := readLines(path, nil)
+					if err != nil {
+						return err
+					}
+					files = append(files, lint.File{Name: path, Lines: lines})
+				}
+
+				if len(args) == 0 && globals.Config != "" {
+					cfg, err := loadConfig(globals, "")
+					if err != nil {
+						return err
+					}
+					open, err := compiler.SourceOpener(context.Background(), cfg, compiler.WithLogger(globals.Logger))
+					if err != nil {
+						return err
+					}
+					for _, source := range cfg.AllSources() {
+						lines, err := readLines(source.Source, open(source))
+						if err != nil {
+							return err
+						}
+						files = append(files, lint.File{Name: fetch.Redact(source.Source), Lines: lines})
+					}
+				}
+				if len(files) == 0 {
+					return cli.Usagef("expected the files to lint or --config")
+				}
+
+				var diagnostics []lint.Diagnostic = lint.Lint(files)
+				if err := lint.WriteReport(os.Stdout, *report, diagnostics); err != nil {
+					return err
+				}
+
+				if errors := lint.Errors(diagnostics); errors > 0 {
+					return cli.ExitError{Code: cli.EXIT_ERROR, Message: fmt.Sprintf("found %d errors", errors)}
+				}
+				return nil
+			}
+		},
+	}
+}
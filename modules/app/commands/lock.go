@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/lock"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func Lock() cli.Command {
+	return cli.Command{
+		Name:    "lock",
+		Summary: "Fetch the sources and record their content in a lockfile, compile --locked builds from it.",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			input := fs.String("input", DEFAULT_INPUT, "path to input list of URLs/files, used when there is no --config")
+			lockfilePath := fs.String("lockfile", lock.DEFAULT_LOCKFILE, "path of the lockfile to write")
+			vendor := fs.String("vendor", "", "directory to copy the content of the sources to, the cache is used when empty")
+			platforms := fs.String("platform", strings.Join(preprocessor.DEFAULT_PLATFORMS, ","), "comma-separated platform constants for !#if directives")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) > 0 {
+					return cli.Usagef("unexpected arguments: %s", strings.Join(args, " "))
+				}
+				if *lockfilePath == "" {
+					return cli.Usagef("--lockfile cannot be empty")
+				}
+
+				cfg, err := loadConfig(globals, *input)
+				if err != nil {
+					return err
+				}
+
+				var store lock.Store = lock.NewStore(cache.New(globals.CacheDir).SourcesDir())
+				var vendorDir string
+				if *vendor != "" {
+					store = lock.NewStore(*vendor)
+					if vendorDir, err = relativeTo(*lockfilePath, *vendor); err != nil {
+						return err
+					}
+				}
+
+				lockfile, err := compiler.Lock(context.Background(), cfg, store,
+					compiler.WithLogger(globals.Logger),
+					compiler.WithPlatforms(strings.Split(*platforms, ",")...),
+				)
+				if err != nil {
+					return fmt.Errorf("failed to lock the sources: %w", err)
+				}
+				lockfile.Vendor = vendorDir
+
+				if err := lockfile.Write(*lockfilePath); err != nil {
+					return fmt.Errorf("failed to write the lockfile: %w", err)
+				}
+				if !globals.Quiet {
+					fmt.Printf("Locked %d sources (%d files) to %s\n", len(lockfile.Sources), lockfile.Files(), *lockfilePath)
+				}
+				return nil
+			}
+		},
+	}
+}
+
+// Path of dir relative to the directory of the lockfile, with slashes
+func relativeTo(lockfilePath string, dir string) (string, error) {
+	base, err := filepath.Abs(filepath.Dir(lockfilePath))
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", fmt.Errorf("the vendor directory must be reachable from the lockfile: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+/**
+ * Loads the lockfile and the store holding its content, the vendor
+ * directory next to the lockfile or the cache.
+ */
+func loadLockfile(globals cli.Globals, lockfilePath string) (lock.Lockfile, lock.Store, error) {
+	lockfile, err := lock.Load(lockfilePath)
+	if err != nil {
+		return lockfile, lock.Store{}, err
+	}
+
+	if lockfile.Vendor == "" {
+		return lockfile, lock.NewStore(cache.New(globals.CacheDir).SourcesDir()), nil
+	}
+	return lockfile, lock.NewStore(filepath.Join(filepath.Dir(lockfilePath), filepath.FromSlash(lockfile.Vendor))), nil
+}
@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/cache"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/server"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func Serve() cli.Command {
+	return cli.Command{
+		Name:    "serve",
+		Summary: "Compile the lists on a schedule and serve them over HTTP, with a health endpoint.",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			input := fs.String("input", DEFAULT_INPUT, "path to input list of URLs/files, used when there is no --config")
+			listen := fs.String("listen", ":8080", "address to listen on")
+			interval := fs.Duration("interval", time.Hour, "time between two builds")
+			platforms := fs.String("platform", strings.Join(preprocessor.DEFAULT_PLATFORMS, ","), "comma-separated platform constants for !#if directives")
+			jobs := fs.Int("jobs", runtime.NumCPU(), "number of lists of the config compiled at the same time")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) > 0 {
+					return cli.Usagef("unexpected arguments: %s", strings.Join(args, " "))
+				}
+				if *interval < time.Minute {
+					return cli.Usagef("--interval must be at least 1m")
+				}
+				if *jobs < 1 {
+					return cli.Usagef("--jobs must be at least 1")
+				}
+
+				cfg, err := loadConfig(globals, *input)
+				if err != nil {
+					return err
+				}
+				if len(cfg.Outputs) == 0 && len(cfg.Lists) == 0 {
+					cfg.Outputs = []config.Output{{Path: DEFAULT_OUTPUT, Format: globals.Format}}
+				}
+				lists, err := servedLists(cfg)
+				if err != nil {
+					return err
+				}
+
+				var names []string
+				var previous map[string]compiler.GuardCounts = make(map[string]compiler.GuardCounts)
+				for _, listCfg := range lists {
+					names = append(names, listName(listCfg))
+					if counts, found := previousCounts(cache.New(globals.CacheDir), listCfg); found {
+						previous[listName(listCfg)] = counts
+					}
+				}
+
+				var b *builder = &builder{
+					globals:  globals,
+					cfg:      cfg,
+					server:   server.New(names, nil),
+					previous: previous,
+					opts: []compiler.Option{
+						compiler.WithLogger(globals.Logger),
+						compiler.WithPlatforms(strings.Split(*platforms, ",")...),
+						compiler.WithFormat(globals.Format),
+						compiler.WithParallelism(*jobs),
+					},
+				}
+
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return serve(ctx, globals, *listen, b.server.Handler(), func() {
+					b.build(ctx)
+					var ticker *time.Ticker = time.NewTicker(*interval)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-ctx.Done():
+							return
+						case <-ticker.C:
+							b.build(ctx)
+						}
+					}
+				})
+			}
+		},
+	}
+}
+
+/**
+ * The lists the config is served as: its lists, or the config itself.
+ * Every output is served under its file name, without .gz since the
+ * server compresses the files itself, so the names have to be unique.
+ */
+func servedLists(cfg config.Config) ([]config.Config, error) {
+	var lists []config.Config = []config.Config{cfg}
+	if len(cfg.Lists) > 0 {
+		lists = cfg.ListConfigs()
+	}
+
+	var names map[string]string = make(map[string]string)
+	for _, listCfg := range lists {
+		for _, output := range listCfg.Outputs {
+			var name string = servedName(output)
+			if other, found := names[name]; found {
+				return nil, cli.Usagef("%s and %s are both served as /%s", other, output.Path, name)
+			}
+			names[name] = output.Path
+		}
+	}
+	return lists, nil
+}
+
+func servedName(output config.Output) string {
+	return strings.TrimSuffix(filepath.Base(output.Path), ".gz")
+}
+
+// Name of a list on the health endpoint, the one its build is cached under
+func listName(listCfg config.Config) string {
+	return buildName(listCfg, listCfg.Outputs[0].Path)
+}
+
+// Compiles the lists of the config and publishes them on the server
+type builder struct {
+	globals cli.Globals
+	cfg     config.Config
+	server  *server.Server
+	opts    []compiler.Option
+	// Counts of the builds being served, for the guards
+	previous map[string]compiler.GuardCounts
+}
+
+func (b *builder) compile(ctx context.Context) ([]compiler.ListResult, error) {
+	if len(b.cfg.Lists) > 0 {
+		return compiler.CompileLists(ctx, b.cfg, append(b.opts, compiler.WithPreviousBuilds(b.previous))...)
+	}
+
+	var opts []compiler.Option = b.opts
+	if counts, found := b.previous[listName(b.cfg)]; found {
+		opts = append(opts, compiler.WithPreviousBuild(counts))
+	}
+	result, err := compiler.Compile(ctx, b.cfg, opts...)
+	return []compiler.ListResult{{Config: b.cfg, Result: result, Err: err}}, nil
+}
+
+/**
+ * Builds every list and swaps in those that were built. A list that
+ * failed, or breached its guards, keeps serving its previous build.
+ */
+func (b *builder) build(ctx context.Context) {
+	var start time.Time = time.Now()
+	results, err := b.compile(ctx)
+	if err != nil {
+		b.globals.Logger.Error("the lists were not built", "error", err)
+		return
+	}
+
+	for _, list := range results {
+		var name string = listName(list.Config)
+		if list.Err == nil && len(list.Result.Breaches) > 0 {
+			list.Err = &compiler.GuardError{Breaches: list.Result.Breaches}
+		}
+		if list.Err == nil {
+			var files []server.File
+			for _, rendered := range list.Result.Outputs {
+				files = append(files, server.File{Name: servedName(rendered.Output), Lines: rendered.Lines})
+			}
+			list.Err = b.server.Publish(name, files, len(list.Result.Rules))
+		}
+
+		if list.Err != nil {
+			if ctx.Err() == nil {
+				b.globals.Logger.Error("the list was not built", "list", name, "error", list.Err)
+				b.server.Fail(name, list.Err)
+			}
+			continue
+		}
+		b.previous[name] = list.Result.Counts()
+		b.globals.Logger.Info("list published", "list", name, "rules", len(list.Result.Rules))
+	}
+	b.globals.Logger.Info("build finished", "lists", len(results), "duration", time.Since(start))
+}
+
+/**
+ * Serves the handler and runs the builds until the context is done, then
+ * shuts the server down gracefully.
+ */
+func serve(ctx context.Context, globals cli.Globals, listen string, handler http.Handler, run func()) error {
+	var httpServer *http.Server = &http.Server{Addr: listen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	var failed chan error = make(chan error, 1)
+	go func() {
+		failed <- httpServer.ListenAndServe()
+	}()
+	globals.Logger.Info("serving", "address", listen, "health", server.HEALTH_PATH)
+
+	var done chan struct{} = make(chan struct{})
+	go func() {
+		defer close(done)
+		run()
+	}()
+
+	select {
+	case err := <-failed:
+		return fmt.Errorf("unable to serve on %s: %w", listen, err)
+	case <-ctx.Done():
+	}
+
+	globals.Logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"context"
+	"dns-hostlist-compiler/compiler"
+	"dns-hostlist-compiler/modules/app/cli"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/stats"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func Stats() cli.Command {
+	return cli.Command{
+		Name:    "stats",
+		Summary: "Show the lines, comments, invalid and unique rules of every source and how much the sources overlap.",
+		Setup: func(fs *flag.FlagSet) func(globals cli.Globals, args []string) error {
+			input := fs.String("input", DEFAULT_INPUT, "path to input list of URLs/files, used when there is no --config")
+			platforms := fs.String("platform", strings.Join(preprocessor.DEFAULT_PLATFORMS, ","), "comma-separated platform constants for !#if directives")
+			report := fs.String("report", "text", "report format: text or json")
+
+			return func(globals cli.Globals, args []string) error {
+				if len(args) > 0 {
+					return cli.Usagef("unexpected arguments: %s", strings.Join(args, " "))
+				}
+				if *report != "text" && *report != "json" {
+					return cli.Usagef("invalid --report %q", *report)
+				}
+
+				cfg, err := loadConfig(globals, *input)
+				if err != nil {
+					return err
+				}
+
+				open, err := compiler.SourceOpener(context.Background(), cfg, compiler.WithLogger(globals.Logger))
+				if err != nil {
+					return err
+				}
+
+				var collector *stats.Collector = stats.New()
+				for _, source := range cfg.AllSources() {
+					var pre *preprocessor.Preprocessor = preprocessor.New(strings.Split(*platforms, ","), open(source))
+					err := collector.AddSource(source.Name, fetch.Redact(source.Source), func(emit func(line string)) error {
+						return pre.Process(source.Source, emit)
+					})
+					if err != nil {
+						return fmt.Errorf("unable to download %s: %w", fetch.Redact(source.Source), err)
+					}
+				}
+
+				if *report == "json" {
+					return stats.WriteJSON(os.Stdout, collector.Result())
+				}
+				return stats.WriteTable(os.Stdout, collector.Result())
+			}
+		},
+	}
+}
@@ -2,8 +2,11 @@ package io
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -29,14 +32,146 @@ func ReadLinksFromFile(path string) ([]string, error) {
 	return links, nil
 }
 
+// Mode of a new output file when WriteOptions.Mode is not set
+const DEFAULT_MODE os.FileMode = 0o644
+
+type WriteOptions struct {
+	// Write the lines gzip-compressed, for mirrors serving list.txt.gz
+	Gzip bool
+	// Number of previous versions kept as path.1 (the latest) to path.N
+	Backups int
+	// Permissions of the file, those of the file being replaced or
+	// DEFAULT_MODE when 0
+	Mode os.FileMode
+}
+
 func WriteLines(path string, lines []string) error {
-	f, err := os.Create(path)
+	return WriteFile(path, lines, WriteOptions{})
+}
+
+/**
+ * Writes the lines to a temporary file next to path, syncs it and renames
+ * it over path. Readers see the previous file or the new one, never a
+ * part of it, and a crash leaves the previous file in place.
+ */
+func WriteFile(path string, lines []string, options WriteOptions) error {
+	var mode os.FileMode = options.Mode
+	if mode == 0 {
+		mode = DEFAULT_MODE
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	var temp string = f.Name()
+	defer os.Remove(temp)
+
+	if err := writeContent(f, lines, options.Gzip); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp, mode); err != nil {
+		return err
+	}
+
+	if err := rotateBackups(path, options.Backups); err != nil {
+		return fmt.Errorf("unable to keep the previous versions of %s: %w", path, err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+func writeContent(f *os.File, lines []string, compressed bool) error {
+	if !compressed {
+		return writeLines(f, lines)
+	}
+
+	gz := gzip.NewWriter(f)
+	if err := writeLines(gz, lines); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+/**
+ * Shifts path.1 to path.2 and so on, dropping the oldest, and keeps the
+ * current file as path.1. The current file is linked, not moved, so
+ * path exists until the new version is renamed over it.
+ */
+func rotateBackups(path string, backups int) error {
+	if backups <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.Remove(backupPath(path, backups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := backups - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(path, n), backupPath(path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Link(path, backupPath(path, 1)); err == nil {
+		return nil
+	}
+	// Hard links are not supported everywhere
+	return copyFile(path, backupPath(path, 1))
+}
+
+func copyFile(from string, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Makes the rename durable, directories cannot be synced on every system
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
 
-	w := bufio.NewWriter(f)
+func writeLines(out io.Writer, lines []string) error {
+	w := bufio.NewWriter(out)
 	for _, l := range lines {
 		if _, err := w.WriteString(l + "\n"); err != nil {
 			return err
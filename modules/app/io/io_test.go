@@ -0,0 +1,71 @@
+package io
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteFile(t *testing.T) {
+	var dir string = t.TempDir()
+	var path string = filepath.Join(dir, "list.txt")
+
+	for _, version := range []string{"one", "two", "three", "four"} {
+		if err := WriteFile(path, []string{version}, WriteOptions{Backups: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{"list.txt": "four\n", "list.txt.1": "three\n", "list.txt.2": "two\n"} {
+		if got := readFile(t, filepath.Join(dir, file)); got != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("files left in the directory: %v", entries)
+	}
+}
+
+func TestWriteFileModeAndGzip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not POSIX on Windows")
+	}
+	var path string = filepath.Join(t.TempDir(), "list.txt.gz")
+
+	if err := WriteFile(path, []string{"||a.org^", "||b.org^"}, WriteOptions{Gzip: true, Mode: 0o640}); err != nil {
+		t.Fatal(err)
+	}
+	// The mode of the replaced file is kept
+	if err := WriteFile(path, []string{"||a.org^", "||b.org^"}, WriteOptions{Gzip: true}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(gz); err != nil || string(content) != "||a.org^\n||b.org^\n" {
+		t.Errorf("content = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"bufio"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LimitError is returned when a source or the build exceeds one of its limits
+type LimitError struct {
+	// "maxBytes", "maxLines" or "maxRules"
+	Limit string
+	Max   int64
+	// Name of the source, empty for the whole build
+	Source string
+	// config.LIMIT_ERROR or config.LIMIT_TRUNCATE
+	OnExceed string
+}
+
+func (e *LimitError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("the build exceeds its %s of %d", e.Limit, e.Max)
+	}
+	return fmt.Sprintf("%s exceeds its %s of %d", e.Source, e.Limit, e.Max)
+}
+
+func (e *LimitError) truncated() bool {
+	return e.OnExceed == config.LIMIT_TRUNCATE
+}
+
+// What was read so far by a source or by the build
+type budget struct {
+	limits config.Limits
+	source string
+	bytes  int64
+	lines  int64
+	rules  int64
+}
+
+func (b *budget) exceed(limit string, max int64) *LimitError {
+	return &LimitError{Limit: limit, Max: max, Source: b.source, OnExceed: b.limits.OnExceed}
+}
+
+// Whether what a source read still fits in the limits
+func (b *budget) fits(used *budget) bool {
+	return (b.limits.MaxBytes == 0 || b.bytes+used.bytes <= b.limits.MaxBytes) &&
+		(b.limits.MaxLines == 0 || b.lines+used.lines <= b.limits.MaxLines) &&
+		(b.limits.MaxRules == 0 || b.rules+used.rules <= b.limits.MaxRules)
+}
+
+func (b *budget) add(used *budget) {
+	b.bytes += used.bytes
+	b.lines += used.lines
+	b.rules += used.rules
+}
+
+/**
+ * limiter checks a source against its own limits and those of the build.
+ * Once a limit is exceeded nothing more of the source is passed on.
+ */
+type limiter struct {
+	budgets  []*budget
+	exceeded *LimitError
+}
+
+func newLimiter(source config.Source, build *budget) *limiter {
+	var l *limiter = &limiter{budgets: []*budget{build}}
+	if source.Limits != nil {
+		var name string = source.Name
+		if name == "" {
+			name = fetch.Redact(source.Source)
+		}
+		l.budgets = append([]*budget{{limits: *source.Limits, source: name}}, l.budgets...)
+	}
+	return l
+}
+
+// Counts a line read from a file, complete is false for a part of a very long line
+func (l *limiter) line(line []byte, complete bool) *LimitError {
+	if l.exceeded != nil {
+		return l.exceeded
+	}
+
+	for _, b := range l.budgets {
+		if b.limits.MaxBytes > 0 && b.bytes+int64(len(line)) > b.limits.MaxBytes {
+			l.exceeded = b.exceed("maxBytes", b.limits.MaxBytes)
+			return l.exceeded
+		}
+		if complete && b.limits.MaxLines > 0 && b.lines+1 > b.limits.MaxLines {
+			l.exceeded = b.exceed("maxLines", b.limits.MaxLines)
+			return l.exceeded
+		}
+	}
+
+	for _, b := range l.budgets {
+		b.bytes += int64(len(line))
+		if complete {
+			b.lines += 1
+		}
+	}
+	return nil
+}
+
+// Counts a rule passed to the stages, false when it has to be dropped
+func (l *limiter) rule() bool {
+	if l.exceeded != nil {
+		return false
+	}
+
+	for _, b := range l.budgets {
+		if b.limits.MaxRules > 0 && b.rules+1 > b.limits.MaxRules {
+			l.exceeded = b.exceed("maxRules", b.limits.MaxRules)
+			return false
+		}
+	}
+	for _, b := range l.budgets {
+		b.rules += 1
+	}
+	return true
+}
+
+/**
+ * limitedBody passes the content on line by line, so a source that is
+ * truncated ends with its last complete line and never with a part of a
+ * rule. A line longer than the buffer of the reader is gathered before it
+ * is passed on, up to preprocessor.MAX_LINE_LENGTH which the preprocessor
+ * rejects anyway.
+ */
+type limitedBody struct {
+	reader  *bufio.Reader
+	closer  io.Closer
+	limiter *limiter
+	// Start of a line longer than the buffer of the reader
+	partial []byte
+	pending []byte
+	err     error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	for len(b.pending) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.limiter.exceeded != nil {
+			return 0, b.limiter.exceeded
+		}
+
+		line, err := b.reader.ReadSlice('\n')
+		var complete bool = err != bufio.ErrBufferFull
+		if len(line) > 0 {
+			if exceeded := b.limiter.line(line, complete); exceeded != nil {
+				// The start of the line was never passed on
+				b.partial = nil
+				return 0, exceeded
+			}
+			if !complete || b.partial != nil {
+				b.partial = append(b.partial, line...)
+				line = b.partial
+			}
+			if complete || len(b.partial) > preprocessor.MAX_LINE_LENGTH {
+				b.pending = line
+				b.partial = nil
+			}
+		}
+		if err != nil && complete {
+			b.err = err
+		}
+	}
+
+	var n int = copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *limitedBody) Close() error {
+	return b.closer.Close()
+}
+
+/**
+ * Rejects content that is not text, such as the HTML error page of a
+ * mirror or a binary file. The first bytes are sniffed the way browsers
+ * do it, only text/plain in UTF-8 is a list.
+ */
+func checkText(location string, reader *bufio.Reader) error {
+	head, _ := reader.Peek(512)
+	if len(head) == 0 {
+		return nil
+	}
+
+	var contentType string = http.DetectContentType(head)
+	if contentType != "text/plain; charset=utf-8" {
+		return fmt.Errorf("%s is not a list, its content looks like %s", fetch.Redact(location), strings.TrimSuffix(contentType, "; charset=utf-8"))
+	}
+	return nil
+}
+
+// Opens the files of a source through its limiter
+func limiting(open preprocessor.Opener, l *limiter) preprocessor.Opener {
+	return func(location string) (io.ReadCloser, error) {
+		body, err := open(location)
+		if err != nil {
+			return nil, err
+		}
+
+		var reader *bufio.Reader = bufio.NewReaderSize(body, 64*1024)
+		if err := checkText(location, reader); err != nil {
+			body.Close()
+			return nil, err
+		}
+		return &limitedBody{reader: reader, closer: body, limiter: l}, nil
+	}
+}
@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+)
+
+/**
+ * ParsedSources keeps the sources read by the builds given it, their
+ * rules after the preprocessor and without the comments, so that the
+ * next builds compile them without reading them again: the lists of a
+ * config sharing a source, or the builds of a list whose sources did not
+ * change. A source is read once even when the builds run at the same
+ * time, the others wait for it. The limits of the build still apply, a
+ * source that does not fit in them is read again.
+ */
+type ParsedSources struct {
+	keep    func(source config.Source) bool
+	mu      sync.Mutex
+	sources map[string]*parsedSource
+}
+
+type parsedSource struct {
+	done chan struct{}
+	// The source and the files it includes
+	files []string
+	rules []string
+	// What the source read, without the limits of the build
+	used   budget
+	digest string
+	// The limit of the source it was truncated at
+	exceeded *LimitError
+	err      error
+}
+
+// Keeps every source when keep is nil, otherwise those keep returns true for
+func NewParsedSources(keep func(source config.Source) bool) *ParsedSources {
+	return &ParsedSources{keep: keep, sources: make(map[string]*parsedSource)}
+}
+
+// Drops the sources that read one of the files, the next build reads them again
+func (p *ParsedSources) Forget(files []string) {
+	var forgotten map[string]bool = make(map[string]bool)
+	for _, file := range files {
+		forgotten[file] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, parsed := range p.sources {
+		select {
+		case <-parsed.done:
+		default:
+			// Still being read, it is not kept when it fails
+			continue
+		}
+		for _, file := range parsed.files {
+			if forgotten[file] {
+				delete(p.sources, key)
+				break
+			}
+		}
+	}
+}
+
+// Drops every source, for the builds that cannot tell which ones changed
+func (p *ParsedSources) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, parsed := range p.sources {
+		select {
+		case <-parsed.done:
+			delete(p.sources, key)
+		default:
+		}
+	}
+}
+
+func (p *ParsedSources) keeps(source config.Source) bool {
+	return p.keep == nil || p.keep(source)
+}
+
+// Everything but the name, sha256 and guard of the source changes its rules
+func parsedKey(source config.Source, platforms []string) string {
+	data, _ := json.Marshal(struct {
+		Source    string
+		Headers   map[string]string
+		Auth      *config.Auth
+		Limits    *config.Limits
+		Platforms []string
+	}{source.Source, source.Headers, source.Auth, source.Limits, platforms})
+	return string(data)
+}
+
+/**
+ * Returns the source as it was read by this build or another one. When
+ * the build reading it fails, the builds waiting for it read it again.
+ */
+func (p *ParsedSources) get(ctx context.Context, source config.Source, options Options) (*parsedSource, error) {
+	var key string = parsedKey(source, options.Platforms)
+
+	for {
+		p.mu.Lock()
+		parsed, found := p.sources[key]
+		if !found {
+			parsed = &parsedSource{done: make(chan struct{})}
+			p.sources[key] = parsed
+		}
+		p.mu.Unlock()
+
+		if !found {
+			parse(ctx, source, options, parsed)
+			if parsed.err != nil {
+				p.mu.Lock()
+				delete(p.sources, key)
+				p.mu.Unlock()
+			}
+			close(parsed.done)
+		}
+
+		select {
+		case <-parsed.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if parsed.err != nil && found {
+			continue
+		}
+		return parsed, parsed.err
+	}
+}
+
+// Reads the source the way readSource does, into memory
+func parse(ctx context.Context, source config.Source, options Options, parsed *parsedSource) {
+	var open preprocessor.Opener
+	if options.Open != nil {
+		open = options.Open(source)
+	}
+	open = cancelable(ctx, open)
+	var recording preprocessor.Opener = func(location string) (io.ReadCloser, error) {
+		parsed.files = append(parsed.files, location)
+		return open(location)
+	}
+
+	var digest hash.Hash = sha256.New()
+	var l *limiter = newLimiter(source, &parsed.used)
+	var pre *preprocessor.Preprocessor = preprocessor.New(options.Platforms, limiting(hashing(source.Source, recording, digest), l))
+
+	err := pre.Process(source.Source, func(line string) {
+		if ruleUtils.IsComment(line) || !l.rule() {
+			return
+		}
+		parsed.rules = append(parsed.rules, line)
+	})
+	if err == nil && l.exceeded != nil {
+		err = l.exceeded
+	}
+
+	var exceeded *LimitError
+	if errors.As(err, &exceeded) && exceeded.truncated() {
+		parsed.exceeded = exceeded
+		err = nil
+	}
+	parsed.err = err
+	parsed.digest = hex.EncodeToString(digest.Sum(nil))
+}
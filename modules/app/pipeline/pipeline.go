@@ -1,16 +1,235 @@
 package pipeline
 
 import (
+	"context"
+	"crypto/sha256"
 	"dns-hostlist-compiler/modules/compress"
+	"dns-hostlist-compiler/modules/config"
 	"dns-hostlist-compiler/modules/deduplicate"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/preprocessor"
 	removecomments "dns-hostlist-compiler/modules/remove/removeComments"
 	removemodifers "dns-hostlist-compiler/modules/remove/removeModifers"
-	"dns-hostlist-compiler/modules/utils"
+	"dns-hostlist-compiler/modules/ruleUtils"
 	"dns-hostlist-compiler/modules/validate"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
 )
 
+// Number of rules handed to the stages at once
+const chunkSize = 4096
+
+type Options struct {
+	// Platform constants the !#if directives are evaluated against
+	Platforms []string
+	// Receives the per-stage metrics, slog.Default() when nil
+	Logger *slog.Logger
+	// Returns the opener for a source and the files it includes,
+	// fetch.Default is used when nil
+	Open func(source config.Source) preprocessor.Opener
+	// What a source not matching its sha256 does,
+	// config.INTEGRITY_FAIL when empty
+	Integrity string
+	// Limits of the whole build, the sources have their own
+	Limits config.Limits
+	// Keeps the rules on the subdomains of blocked hostnames, for the lists
+	// written as hosts files
+	KeepSubdomains bool
+	// The sources read by other builds, the sources are read here when nil
+	Parsed *ParsedSources
+}
+
+// Integrity of a source
+const (
+	UNPINNED = "unpinned"
+	VERIFIED = "verified"
+	MISMATCH = "mismatch"
+	// Only a part of the source was read, it cannot be checked
+	TRUNCATED = "truncated"
+)
+
+type SourceStats struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Rules left after the comments were removed
+	Rules int `json:"rules"`
+	// Hex SHA-256 of the content of the source, without its includes
+	SHA256    string `json:"sha256"`
+	Integrity string `json:"integrity"`
+	// The limit the source was truncated at
+	Truncated string `json:"truncated,omitempty"`
+}
+
+/**
+ * StageMetrics is measured around every call of a stage.
+ * The allocations are read from runtime/metrics and include everything
+ * allocated by the process during the calls, the pipeline itself runs on a
+ * single goroutine. The runtime counts small allocations in batches, so
+ * the numbers are only meaningful on large lists.
+ */
+type StageMetrics struct {
+	Name           string        `json:"name"`
+	RulesIn        int           `json:"rulesIn"`
+	RulesOut       int           `json:"rulesOut"`
+	Duration       time.Duration `json:"durationNs"`
+	AllocatedBytes uint64        `json:"allocatedBytes"`
+	Allocations    uint64        `json:"allocations"`
+}
+
+type Result struct {
+	Rules   []string
+	Sources []SourceStats
+	// The stages in order, deduplicate last
+	Stages        []StageMetrics
+	Duration      time.Duration
+	PeakHeapInUse uint64
+}
+
+/**
+ * Stage is a transformation that works on the rules as they are read.
+ *
+ * Process receives the rules in chunks and returns the rules to pass on
+ * to the next stage. The returned slice is only valid until the next call.
+ * Stages that need to see every rule before deciding (compress) keep their
+ * own state and return the result from Flush.
+ */
+type Stage interface {
+	Name() string
+	Process(rules []string) []string
+	Flush() []string
+}
+
+type meteredStage struct {
+	Stage
+	metrics StageMetrics
+}
+
+var allocationMetrics []string = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+type meter struct {
+	samples []metrics.Sample
+}
+
+func newMeter() *meter {
+	var m *meter = &meter{}
+	for _, name := range allocationMetrics {
+		m.samples = append(m.samples, metrics.Sample{Name: name})
+	}
+	return m
+}
+
+func (m *meter) allocations() (uint64, uint64) {
+	metrics.Read(m.samples)
+	return m.samples[0].Value.Uint64(), m.samples[1].Value.Uint64()
+}
+
+// Runs f and adds its duration and allocations to the metrics
+func (m *meter) measure(stageMetrics *StageMetrics, f func()) {
+	bytesBefore, objectsBefore := m.allocations()
+	var start time.Time = time.Now()
+
+	f()
+
+	stageMetrics.Duration += time.Since(start)
+	bytesAfter, objectsAfter := m.allocations()
+	stageMetrics.AllocatedBytes += bytesAfter - bytesBefore
+	stageMetrics.Allocations += objectsAfter - objectsBefore
+}
+
+type chain struct {
+	stages []*meteredStage
+	rules  []string
+	meter  *meter
+}
+
+func newChain(stages ...Stage) *chain {
+	var c *chain = &chain{meter: newMeter()}
+	for _, stage := range stages {
+		c.stages = append(c.stages, &meteredStage{Stage: stage, metrics: StageMetrics{Name: stage.Name()}})
+	}
+	return c
+}
+
+func (c *chain) push(from int, rules []string) {
+	for i := from; i < len(c.stages) && len(rules) > 0; i += 1 {
+		var stage *meteredStage = c.stages[i]
+		stage.metrics.RulesIn += len(rules)
+		c.meter.measure(&stage.metrics, func() {
+			rules = stage.Process(rules)
+		})
+		stage.metrics.RulesOut += len(rules)
+	}
+	c.rules = append(c.rules, rules...)
+}
+
+func (c *chain) flush() []string {
+	for i, stage := range c.stages {
+		var rules []string
+		c.meter.measure(&stage.metrics, func() {
+			rules = stage.Flush()
+		})
+		stage.metrics.RulesOut += len(rules)
+		for len(rules) > 0 {
+			var n int = min(len(rules), chunkSize)
+			c.push(i+1, rules[:n])
+			rules = rules[n:]
+		}
+	}
+	return c.rules
+}
+
+func logStage(logger *slog.Logger, stageMetrics StageMetrics) {
+	logger.Info("stage",
+		"name", stageMetrics.Name,
+		"in", stageMetrics.RulesIn,
+		"out", stageMetrics.RulesOut,
+		"duration", stageMetrics.Duration,
+		"allocated_bytes", stageMetrics.AllocatedBytes,
+		"allocations", stageMetrics.Allocations,
+	)
+}
+
+type memoryUsage struct {
+	peakHeap uint64
+}
+
+func (m *memoryUsage) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.peakHeap = max(m.peakHeap, stats.HeapInuse)
+}
+
+/**
+ * Returns the transformations every rule goes through, in order.
+ * Deduplicate runs on the final list and is not a stage.
+ */
+func NewStages() []Stage {
+	return newStages(false)
+}
+
+func newStages(keepSubdomains bool) []Stage {
+	var compressStream *compress.Stream = compress.NewStream()
+	if keepSubdomains {
+		compressStream = compress.NewSubdomainsStream()
+	}
+	return []Stage{
+		removecomments.NewStream(),
+		compressStream,
+		removemodifers.NewStream(),
+		validate.NewStream(),
+	}
+}
+
 func DedupeSlice[T comparable](sliceList []T) []T {
 	dedupeMap := make(map[T]struct{})
 	list := []T{}
@@ -23,25 +242,247 @@ func DedupeSlice[T comparable](sliceList []T) []T {
 	return list
 }
 
-func RunPipeline(links []string) ([]string, error) {
-	var rules []string
-	re := regexp.MustCompile(`\r?\n`)
+type hashedBody struct {
+	io.Reader
+	io.Closer
+}
+
+/**
+ * Hashes the content of the source itself as the preprocessor reads it,
+ * the files it includes go through open as they are.
+ */
+func hashing(link string, open preprocessor.Opener, digest hash.Hash) preprocessor.Opener {
+	return func(location string) (io.ReadCloser, error) {
+		body, err := open(location)
+		if err != nil || location != link {
+			return body, err
+		}
+		return hashedBody{Reader: io.TeeReader(body, digest), Closer: body}, nil
+	}
+}
+
+type cancelableBody struct {
+	ctx  context.Context
+	body io.ReadCloser
+}
+
+func (b cancelableBody) Read(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.body.Read(p)
+}
+
+func (b cancelableBody) Close() error {
+	return b.body.Close()
+}
+
+/**
+ * Opens the files with fetch.Default when open is nil, and stops reading
+ * them once the context is done.
+ */
+func cancelable(ctx context.Context, open preprocessor.Opener) preprocessor.Opener {
+	return func(location string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var body io.ReadCloser
+		var err error
+		if open == nil {
+			body, err = fetch.Default.Fetch(ctx, location)
+		} else {
+			body, err = open(location)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return cancelableBody{ctx: ctx, body: body}, nil
+	}
+}
+
+func verify(source config.Source, digest string) string {
+	switch {
+	case source.SHA256 == "":
+		return UNPINNED
+	case strings.EqualFold(source.SHA256, digest):
+		return VERIFIED
+	default:
+		return MISMATCH
+	}
+}
+
+/**
+ * Reads a source into the chain and returns the hex SHA-256 of its
+ * content. A source kept by options.Parsed is only read by the first
+ * build, the others push the rules it read.
+ */
+func readSource(ctx context.Context, source config.Source, options Options, build *budget, c *chain) (string, error) {
+	if options.Parsed != nil && options.Parsed.keeps(source) {
+		parsed, err := options.Parsed.get(ctx, source, options)
+		if err != nil {
+			return "", err
+		}
+		if build.fits(&parsed.used) {
+			build.add(&parsed.used)
+			for rules := parsed.rules; len(rules) > 0; {
+				var n int = min(len(rules), chunkSize)
+				c.push(0, rules[:n])
+				rules = rules[n:]
+			}
+			if parsed.exceeded != nil {
+				return parsed.digest, parsed.exceeded
+			}
+			return parsed.digest, nil
+		}
+	}
+
+	var open preprocessor.Opener
+	if options.Open != nil {
+		open = options.Open(source)
+	}
+	var digest hash.Hash = sha256.New()
+	var l *limiter = newLimiter(source, build)
+	var pre *preprocessor.Preprocessor = preprocessor.New(options.Platforms, limiting(hashing(source.Source, cancelable(ctx, open), digest), l))
+
+	var err error = streamSource(source.Source, pre, l, c)
+	return hex.EncodeToString(digest.Sum(nil)), err
+}
+
+func streamSource(link string, pre *preprocessor.Preprocessor, l *limiter, c *chain) error {
+	var chunk []string = make([]string, 0, chunkSize)
+	err := pre.Process(link, func(line string) {
+		if !ruleUtils.IsComment(line) && !l.rule() {
+			return
+		}
+		chunk = append(chunk, line)
+		if len(chunk) == chunkSize {
+			c.push(0, chunk)
+			chunk = chunk[:0]
+		}
+	})
+	if err == nil && l.exceeded != nil {
+		// The rules limit was reached on the last lines
+		err = l.exceeded
+	}
+	c.push(0, chunk)
+
+	return err
+}
+
+/**
+ * Runs every source through the transformations line by line.
+ *
+ * Sources are never held in memory as a whole, but the rules that are
+ * kept are: compress holds every rule it passes on until Flush, so that
+ * the list keeps its order, and deduplicate indexes the rules it has seen.
+ * The peak memory of a build grows with the size of the compiled list,
+ * and with that of the sources kept by options.Parsed.
+ * The preprocessor directives are resolved before the comments are removed.
+ * Once the context is done the files are no longer read and its error is
+ * returned.
+ */
+func RunPipeline(ctx context.Context, sources []config.Source, options Options) (Result, error) {
+	var result Result
+	var logger *slog.Logger = options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var start time.Time = time.Now()
+	var memory memoryUsage
+	var c *chain = newChain(newStages(options.KeepSubdomains)...)
+	var build *budget = &budget{limits: options.Limits}
 
-	for _, l := range links {
-		res, err := utils.Download(l)
+	for _, source := range sources {
+		var rulesBefore int = c.stages[0].metrics.RulesOut
+		var truncated string
+		digest, err := readSource(ctx, source, options, build, c)
 		if err != nil {
-			return nil, fmt.Errorf("unable to download %s: %w", l, err)
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			var exceeded *LimitError
+			if !errors.As(err, &exceeded) {
+				return result, fmt.Errorf("unable to download %s: %w", fetch.Redact(source.Source), err)
+			}
+			if !exceeded.truncated() {
+				return result, exceeded
+			}
+			truncated = exceeded.Error()
+			logger.Warn("source truncated", "source", source.Name, "limit", exceeded.Limit, "max", exceeded.Max)
+		}
+
+		var stats SourceStats = SourceStats{
+			Name:      source.Name,
+			URL:       fetch.Redact(source.Source),
+			Rules:     c.stages[0].metrics.RulesOut - rulesBefore,
+			SHA256:    digest,
+			Truncated: truncated,
+		}
+		stats.Integrity = verify(source, stats.SHA256)
+		if truncated != "" && stats.Integrity != UNPINNED {
+			stats.Integrity = TRUNCATED
 		}
-		parts := re.Split(res, -1)
-		rules = append(rules, parts...)
+		if stats.Integrity == MISMATCH && options.Integrity != config.INTEGRITY_WARN {
+			return result, fmt.Errorf("%s does not match its sha256: expected %s, got %s", stats.URL, strings.ToLower(source.SHA256), stats.SHA256)
+		}
+		result.Sources = append(result.Sources, stats)
+		logger.Debug("source", "name", stats.Name, "url", stats.URL, "rules", stats.Rules, "sha256", stats.SHA256, "integrity", stats.Integrity)
+		memory.sample()
 	}
 
-	// Process pipeline
-	rules = removecomments.RemoveComments(rules)
-	rules = compress.Compress(rules)
-	rules = removemodifers.RemoveModifiers(rules)
-	rules = validate.Validate(rules)
-	rules = deduplicate.Deduplicate(rules)
+	var rules []string = c.flush()
+	memory.sample()
+
+	var dedupe StageMetrics = StageMetrics{Name: "deduplicate", RulesIn: len(rules)}
+	c.meter.measure(&dedupe, func() {
+		result.Rules = deduplicate.Deduplicate(rules)
+	})
+	dedupe.RulesOut = len(result.Rules)
+
+	for _, stage := range c.stages {
+		result.Stages = append(result.Stages, stage.metrics)
+	}
+	result.Stages = append(result.Stages, dedupe)
+	result.Duration = time.Since(start)
+	result.PeakHeapInUse = memory.peakHeap
+
+	for _, stageMetrics := range result.Stages {
+		logStage(logger, stageMetrics)
+	}
+	logger.Info("pipeline", "rules", len(result.Rules), "duration", result.Duration, "peak_heap_in_use_kib", result.PeakHeapInUse/1024)
+	return result, nil
+}
 
-	return rules, nil
+/**
+ * RunReport is the JSON summary of a pipeline run,
+ * everything but the rules themselves.
+ */
+type RunReport struct {
+	Started       time.Time      `json:"started"`
+	Duration      time.Duration  `json:"durationNs"`
+	Rules         int            `json:"rules"`
+	PeakHeapInUse uint64         `json:"peakHeapInUseBytes"`
+	Sources       []SourceStats  `json:"sources"`
+	Stages        []StageMetrics `json:"stages"`
+}
+
+func NewRunReport(result Result, started time.Time) RunReport {
+	return RunReport{
+		Started:       started.UTC(),
+		Duration:      result.Duration,
+		Rules:         len(result.Rules),
+		PeakHeapInUse: result.PeakHeapInUse,
+		Sources:       result.Sources,
+		Stages:        result.Stages,
+	}
+}
+
+func (r RunReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
 }
@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/preprocessor"
+	"dns-hostlist-compiler/modules/testutils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+const (
+	FIRST_SHA256  = "fe1a438103ce76542a97857485f554d809b652ebff8dabaa50dbe158f023d769"
+	SECOND_SHA256 = "e97c1b5664c4cd40a8953f37caee1fbad629a322fd8131a21e2750aeafe7ba6a"
+)
+
+func TestDedupeSlice(t *testing.T) {
+	got := DedupeSlice([]string{"a", "b", "a", "c", "b"})
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DedupeSlice() = %q, want %q", got, want)
+	}
+}
+
+func TestRunPipelineGolden(t *testing.T) {
+	testutils.Golden(t, *update, func(links []string) []string {
+		result, err := RunPipeline(context.Background(), config.SourcesFromLinks(links), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Rules
+	})
+}
+
+func TestRunPipelineCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := RunPipeline(ctx, config.SourcesFromLinks([]string{"testdata/first.txt"}), Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunPipeline() with a canceled context error = %v", err)
+	}
+}
+
+func TestRunPipelineMissingSource(t *testing.T) {
+	if _, err := RunPipeline(context.Background(), config.SourcesFromLinks([]string{"testdata/missing.txt"}), Options{}); err == nil {
+		t.Errorf("RunPipeline() error = nil")
+	}
+}
+
+func TestRunPipelineSourceStats(t *testing.T) {
+	result, err := RunPipeline(context.Background(), []config.Source{
+		{Name: "First", Source: "testdata/first.txt", SHA256: strings.ToUpper(FIRST_SHA256)},
+		{Name: "Second", Source: "testdata/second.txt"},
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []SourceStats = []SourceStats{
+		{Name: "First", URL: "testdata/first.txt", Rules: 8, SHA256: FIRST_SHA256, Integrity: VERIFIED},
+		{Name: "Second", URL: "testdata/second.txt", Rules: 5, SHA256: SECOND_SHA256, Integrity: UNPINNED},
+	}
+	if !reflect.DeepEqual(result.Sources, want) {
+		t.Errorf("RunPipeline() sources = %+v, want %+v", result.Sources, want)
+	}
+}
+
+func TestRunPipelineIntegrity(t *testing.T) {
+	var sources []config.Source = []config.Source{
+		{Name: "First", Source: "testdata/first.txt", SHA256: SECOND_SHA256},
+		{Name: "Second", Source: "testdata/second.txt", SHA256: SECOND_SHA256},
+	}
+
+	_, err := RunPipeline(context.Background(), sources, Options{})
+	if err == nil || !strings.Contains(err.Error(), "testdata/first.txt does not match its sha256") || !strings.Contains(err.Error(), FIRST_SHA256) {
+		t.Errorf("RunPipeline() error = %v, want a sha256 mismatch of first.txt", err)
+	}
+
+	result, err := RunPipeline(context.Background(), sources, Options{Integrity: config.INTEGRITY_WARN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Sources[0].Integrity != MISMATCH || result.Sources[1].Integrity != VERIFIED || len(result.Rules) == 0 {
+		t.Errorf("RunPipeline() sources = %+v, rules %d", result.Sources, len(result.Rules))
+	}
+}
+
+func TestRunPipelineStageMetrics(t *testing.T) {
+	var logs bytes.Buffer
+	result, err := RunPipeline(context.Background(), config.SourcesFromLinks([]string{"testdata/first.txt", "testdata/second.txt"}), Options{
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i, stage := range result.Stages {
+		names = append(names, stage.Name)
+		if i > 0 && stage.RulesIn != result.Stages[i-1].RulesOut {
+			t.Errorf("%s received %d rules, %s passed on %d", stage.Name, stage.RulesIn, result.Stages[i-1].Name, result.Stages[i-1].RulesOut)
+		}
+	}
+	if want := []string{"removecomments", "compress", "removemodifiers", "validate", "deduplicate"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("stages = %q, want %q", names, want)
+	}
+	if last := result.Stages[len(result.Stages)-1]; last.RulesOut != len(result.Rules) {
+		t.Errorf("deduplicate passed on %d rules, result has %d", last.RulesOut, len(result.Rules))
+	}
+
+	// One record per stage and one for the whole run
+	var records int = 0
+	for decoder := json.NewDecoder(&logs); decoder.More(); records += 1 {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records != len(result.Stages)+1 {
+		t.Errorf("logged %d records, want %d", records, len(result.Stages)+1)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	result, err := RunPipeline(context.Background(), config.SourcesFromLinks([]string{"testdata/first.txt"}), Options{
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var path string = filepath.Join(t.TempDir(), "report.json")
+	if err := NewRunReport(result, time.Now()).Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report RunReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Rules != len(result.Rules) || len(report.Stages) != len(result.Stages) || len(report.Sources) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestRunPipelineLimits(t *testing.T) {
+	var first config.Source = config.Source{Name: "First", Source: "testdata/first.txt"}
+	var second config.Source = config.Source{Name: "Second", Source: "testdata/second.txt"}
+	var truncate = func(limits config.Limits) *config.Limits {
+		limits.OnExceed = config.LIMIT_TRUNCATE
+		return &limits
+	}
+
+	tests := []struct {
+		name      string
+		sources   []config.Source
+		build     config.Limits
+		wantRules []int
+		truncated []string
+		wantErr   string
+	}{
+		{"lines", []config.Source{{Name: "First", Source: first.Source, Limits: truncate(config.Limits{MaxLines: 3})}}, config.Limits{},
+			[]int{2}, []string{"First exceeds its maxLines of 3"}, ""},
+		{"bytes", []config.Source{{Name: "First", Source: first.Source, Limits: truncate(config.Limits{MaxBytes: 30})}}, config.Limits{},
+			[]int{0}, []string{"First exceeds its maxBytes of 30"}, ""},
+		{"rules", []config.Source{{Name: "First", Source: first.Source, Limits: truncate(config.Limits{MaxRules: 4})}, second}, config.Limits{},
+			[]int{4, 5}, []string{"First exceeds its maxRules of 4", ""}, ""},
+		{"build", []config.Source{first, second}, *truncate(config.Limits{MaxRules: 10}),
+			[]int{8, 2}, []string{"", "the build exceeds its maxRules of 10"}, ""},
+		{"error", []config.Source{{Name: "First", Source: first.Source, Limits: &config.Limits{MaxLines: 3}}}, config.Limits{},
+			nil, nil, "First exceeds its maxLines of 3"},
+		{"build error", []config.Source{first, second}, config.Limits{MaxBytes: 200},
+			nil, nil, "the build exceeds its maxBytes of 200"},
+	}
+
+	var parsed *ParsedSources = NewParsedSources(nil)
+	for _, tt := range tests {
+		// Read, then taken from the sources the first build kept
+		for _, name := range []string{tt.name, tt.name + " parsed"} {
+			t.Run(name, func(t *testing.T) {
+				result, err := RunPipeline(context.Background(), tt.sources, Options{Limits: tt.build, Parsed: parsed, Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))})
+				if tt.wantErr != "" {
+					var exceeded *LimitError
+					if !errors.As(err, &exceeded) || err.Error() != tt.wantErr {
+						t.Fatalf("RunPipeline() error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var rules []int
+				var truncated []string
+				for _, source := range result.Sources {
+					rules = append(rules, source.Rules)
+					truncated = append(truncated, source.Truncated)
+				}
+				if !reflect.DeepEqual(rules, tt.wantRules) || !reflect.DeepEqual(truncated, tt.truncated) {
+					t.Errorf("rules = %v, truncated = %q, want %v, %q", rules, truncated, tt.wantRules, tt.truncated)
+				}
+			})
+		}
+	}
+}
+
+func TestRunPipelineParsedSources(t *testing.T) {
+	var opened []string
+	var options Options = Options{
+		Parsed: NewParsedSources(nil),
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Open: func(source config.Source) preprocessor.Opener {
+			return func(location string) (io.ReadCloser, error) {
+				opened = append(opened, location)
+				return os.Open(location)
+			}
+		},
+	}
+	var sources []config.Source = []config.Source{{Name: "First", Source: "testdata/first.txt"}, {Name: "Second", Source: "testdata/second.txt"}}
+
+	read, err := RunPipeline(context.Background(), sources, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := RunPipeline(context.Background(), sources, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kept.Rules, read.Rules) || !reflect.DeepEqual(kept.Sources, read.Sources) {
+		t.Errorf("RunPipeline() of the kept sources = %q, %+v, want %q, %+v", kept.Rules, kept.Sources, read.Rules, read.Sources)
+	}
+	if want := []string{"testdata/first.txt", "testdata/second.txt"}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q, want %q", opened, want)
+	}
+
+	// A source that does not fit in the limits of the build is read again
+	opened = nil
+	options.Limits = config.Limits{MaxRules: 10, OnExceed: config.LIMIT_TRUNCATE}
+	if result, err := RunPipeline(context.Background(), sources, options); err != nil || result.Sources[1].Rules != 2 {
+		t.Errorf("RunPipeline() over the build limits = %+v, %v", result.Sources, err)
+	}
+	if want := []string{"testdata/second.txt"}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q over the build limits, want %q", opened, want)
+	}
+
+	opened = nil
+	options.Limits = config.Limits{}
+	options.Parsed.Forget([]string{"testdata/second.txt"})
+	if _, err := RunPipeline(context.Background(), sources, options); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"testdata/second.txt"}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q after the second source was forgotten, want %q", opened, want)
+	}
+}
+
+func TestRunPipelineTruncatesLongLines(t *testing.T) {
+	var path string = filepath.Join(t.TempDir(), "long.txt")
+	var long string = "||" + strings.Repeat("b", 100_000) + ".org^"
+	if err := os.WriteFile(path, []byte("||a.example.org^\n"+long+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var source config.Source = config.Source{
+		Name:   "Long",
+		Source: path,
+		SHA256: FIRST_SHA256,
+		Limits: &config.Limits{MaxBytes: 70_000, OnExceed: config.LIMIT_TRUNCATE},
+	}
+	result, err := RunPipeline(context.Background(), []config.Source{source}, Options{Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The part of the long line read before the limit is not a rule
+	if want := []string{"||a.example.org^"}; !reflect.DeepEqual(result.Rules, want) {
+		t.Errorf("Rules = %.40q, want %q", result.Rules, want)
+	}
+
+	// Nothing of the long line is passed on to the preprocessor
+	body, err := limiting(func(location string) (io.ReadCloser, error) { return os.Open(location) }, newLimiter(source, &budget{}))(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if read, err := io.ReadAll(body); string(read) != "||a.example.org^\n" || !errors.As(err, new(*LimitError)) {
+		t.Errorf("read %d bytes, %v, want the first line and the limit error", len(read), err)
+	}
+	if result.Sources[0].Integrity != TRUNCATED {
+		t.Errorf("Integrity = %s, want %s", result.Sources[0].Integrity, TRUNCATED)
+	}
+
+	source.Limits = nil
+	source.SHA256 = ""
+	result, err = RunPipeline(context.Background(), []config.Source{source}, Options{Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))})
+	if err != nil || len(result.Rules) != 2 || result.Rules[1] != long {
+		t.Errorf("RunPipeline() without limits = %d rules, %v", len(result.Rules), err)
+	}
+}
+
+func TestRunPipelineRejectsNonText(t *testing.T) {
+	var dir string = t.TempDir()
+	var files map[string]string = map[string]string{
+		"error.html":  "<!DOCTYPE html>\n<html><body>Rate limited</body></html>\n",
+		"archive.bin": "PK\x03\x04\x00\x00\x00\x00binary",
+	}
+
+	for name, content := range files {
+		var path string = filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RunPipeline(context.Background(), config.SourcesFromLinks([]string{path}), Options{}); err == nil || !strings.Contains(err.Error(), "is not a list") {
+			t.Errorf("RunPipeline(%s) error = %v, want a not a list error", name, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	BUILDS_DIR      = "builds"
+	SOURCES_DIR     = "sources"
+	PREVIOUS_SUFFIX = ".previous"
+)
+
+var unsafeNameChars *regexp.Regexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+/**
+ * Cache is a directory holding data kept between runs, such as the
+ * compiled lists of the previous builds.
+ */
+type Cache struct {
+	Dir string
+}
+
+type Entry struct {
+	// Path relative to the cache directory
+	Path     string
+	Size     int64
+	Modified time.Time
+}
+
+func New(dir string) Cache {
+	return Cache{Dir: dir}
+}
+
+// Where the locked sources are kept when they are not vendored
+func (c Cache) SourcesDir() string {
+	return filepath.Join(c.Dir, SOURCES_DIR)
+}
+
+// "My list!" -> "My-list-"
+func fileName(name string) string {
+	return unsafeNameChars.ReplaceAllString(name, "-")
+}
+
+func (c Cache) buildPath(name string) string {
+	return filepath.Join(c.Dir, BUILDS_DIR, fileName(name)+".txt")
+}
+
+func (c Cache) previousBuildPath(name string) string {
+	return filepath.Join(c.Dir, BUILDS_DIR, fileName(name)+PREVIOUS_SUFFIX+".txt")
+}
+
+/**
+ * Stores the compiled list under the given name,
+ * the build stored before is kept as the previous build.
+ */
+func (c Cache) SaveBuild(name string, lines []string) error {
+	var path string = c.buildPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("unable to create the cache directory: %w", err)
+	}
+
+	if err := os.Rename(path, c.previousBuildPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to keep the previous build of %s: %w", name, err)
+	}
+
+	var content string = strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		content += "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+func (c Cache) statsPath(name string) string {
+	return filepath.Join(c.Dir, BUILDS_DIR, fileName(name)+".stats.json")
+}
+
+/**
+ * Stores what is known about the last published build as JSON,
+ * such as its rule counts.
+ */
+func (c Cache) SaveBuildStats(name string, stats any) error {
+	content, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(c.Dir, BUILDS_DIR), 0o755); err != nil {
+		return fmt.Errorf("unable to create the cache directory: %w", err)
+	}
+	return os.WriteFile(c.statsPath(name), content, 0o644)
+}
+
+// Reads the stats stored by SaveBuildStats into stats
+func (c Cache) LoadBuildStats(name string, stats any) error {
+	content, err := os.ReadFile(c.statsPath(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, stats)
+}
+
+func (c Cache) LoadBuild(name string) ([]string, error) {
+	return readLines(c.buildPath(name))
+}
+
+func (c Cache) LoadPreviousBuild(name string) ([]string, error) {
+	return readLines(c.previousBuildPath(name))
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+/**
+ * Lists the files in the cache.
+ */
+func (c Cache) Entries() ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.Dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Path: rel, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
+
+/**
+ * Removes everything from the cache, the directories it keeps its data
+ * in. A directory holding anything else is not a cache directory, it is
+ * refused rather than emptied.
+ */
+func (c Cache) Clear() error {
+	entries, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != BUILDS_DIR && entry.Name() != SOURCES_DIR {
+			return fmt.Errorf("%s is not a cache directory, it contains %s", c.Dir, entry.Name())
+		}
+	}
+
+	for _, dir := range []string{BUILDS_DIR, SOURCES_DIR} {
+		if err := os.RemoveAll(filepath.Join(c.Dir, dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuilds(t *testing.T) {
+	var c Cache = New(t.TempDir())
+
+	if _, err := c.LoadBuild("My list"); err == nil {
+		t.Errorf("LoadBuild() before SaveBuild() error = nil")
+	}
+
+	if err := c.SaveBuild("My list", []string{"||a.org^"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SaveBuild("My list", []string{"||a.org^", "||b.org^"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := c.LoadBuild("My list"); err != nil || !reflect.DeepEqual(got, []string{"||a.org^", "||b.org^"}) {
+		t.Errorf("LoadBuild() = %q, %v", got, err)
+	}
+	if got, err := c.LoadPreviousBuild("My list"); err != nil || !reflect.DeepEqual(got, []string{"||a.org^"}) {
+		t.Errorf("LoadPreviousBuild() = %q, %v", got, err)
+	}
+
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 2 || entries[0].Path != "builds/My-list.previous.txt" {
+		t.Errorf("Entries() = %+v, %v", entries, err)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := c.Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("Entries() after Clear() = %+v, %v", entries, err)
+	}
+}
+
+func TestClearRefusesOtherDirectories(t *testing.T) {
+	var c Cache = New(t.TempDir())
+	if err := c.SaveBuild("My list", []string{"||a.org^"}); err != nil {
+		t.Fatal(err)
+	}
+	var other string = filepath.Join(c.Dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Clear(); err == nil {
+		t.Errorf("Clear() of a directory with other files error = nil")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("the other file was removed: %v", err)
+	}
+	if _, err := c.LoadBuild("My list"); err != nil {
+		t.Errorf("the build was removed: %v", err)
+	}
+
+	if err := New(filepath.Join(c.Dir, "missing")).Clear(); err != nil {
+		t.Errorf("Clear() of a missing directory error = %v", err)
+	}
+}
+
+func TestBuildStats(t *testing.T) {
+	var c Cache = New(t.TempDir())
+	type counts struct {
+		Rules int `json:"rules"`
+	}
+
+	var got counts
+	if err := c.LoadBuildStats("My list", &got); err == nil {
+		t.Errorf("LoadBuildStats() before SaveBuildStats() error = nil")
+	}
+	if err := c.SaveBuildStats("My list", counts{Rules: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadBuildStats("My list", &got); err != nil || got.Rules != 42 {
+		t.Errorf("LoadBuildStats() = %+v, %v", got, err)
+	}
+}
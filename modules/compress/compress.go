@@ -3,6 +3,8 @@ package compress
 import (
 	"dns-hostlist-compiler/modules/ruleUtils"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -11,15 +13,125 @@ type BlocklistRule struct {
 	CanCompress      bool
 	Hostname         string
 	OriginalRuleText string
+	// ||*.example.org^ -- blocks the subdomains but not the hostname itself
+	Wildcard bool
+	// The rule only has the $important modifier
+	Important bool
 }
 
-func extractHostnames(hostname string) []string {
-	var parts []string = strings.Split(hostname, ".")
-	var domains []string
-	for i := range parts {
-		domains = append(domains, strings.Join(parts[i:], "."))
+var wildcardHostnameRegex *regexp.Regexp = regexp.MustCompile(`^\|\|\*\.([a-z0-9-.]+)\^$`)
+
+// Kinds of rules stored on a trie node
+const (
+	blocksHostname uint8 = 1 << iota
+	blocksHostnameImportant
+	blocksSubdomains
+	blocksSubdomainsImportant
+)
+
+/**
+ * A node of the trie of reversed hostname labels,
+ * "example.org" is stored as "org" -> "example".
+ */
+type trieNode struct {
+	parent   *trieNode
+	children map[string]*trieNode
+	kinds    uint8
+}
+
+func (n *trieNode) child(label string) *trieNode {
+	if n.children == nil {
+		n.children = make(map[string]*trieNode)
+	}
+
+	child, exists := n.children[label]
+	if !exists {
+		child = &trieNode{parent: n}
+		n.children[label] = child
+	}
+	return child
+}
+
+// Walks the labels from the TLD down to the hostname itself
+func (n *trieNode) insert(hostname string) *trieNode {
+	var node *trieNode = n
+	for len(hostname) > 0 {
+		var dot int = strings.LastIndexByte(hostname, '.')
+		node = node.child(hostname[dot+1:])
+		if dot == -1 {
+			break
+		}
+		hostname = hostname[:dot]
+	}
+	return node
+}
+
+func ruleKind(rule BlocklistRule) uint8 {
+	var kind uint8 = blocksHostname
+	if rule.Wildcard {
+		kind = blocksSubdomains
+	}
+	if rule.Important {
+		kind <<= 1
+	}
+	return kind
+}
+
+/**
+ * Finds the rule that makes a rule of the given kind stored on the node
+ * redundant and returns its node and kind, nil when it is not covered.
+ *
+ * Any rule on a parent node blocks the subdomains, but only $important
+ * rules can cover other $important rules. On the node itself a rule is only
+ * covered by a wider one: ||example.org^ covers ||*.example.org^ and
+ * ||example.org^$important covers ||example.org^.
+ */
+func coveringRule(node *trieNode, kind uint8) (*trieNode, uint8) {
+	var important bool = kind&(blocksHostnameImportant|blocksSubdomainsImportant) != 0
+
+	var wider uint8
+	switch kind {
+	case blocksHostname:
+		wider = blocksHostnameImportant
+	case blocksSubdomains:
+		wider = blocksHostname | blocksHostnameImportant | blocksSubdomainsImportant
+	case blocksSubdomainsImportant:
+		wider = blocksHostnameImportant
+	}
+	if kinds := node.kinds & wider; kinds != 0 {
+		return node, kinds & -kinds
+	}
+
+	for parent := node.parent; parent != nil; parent = parent.parent {
+		var kinds uint8 = parent.kinds
+		if important {
+			kinds &= blocksHostnameImportant | blocksSubdomainsImportant
+		}
+		if kinds != 0 {
+			return parent, kinds & -kinds
+		}
+	}
+
+	return nil, 0
+}
+
+func covered(node *trieNode, kind uint8) bool {
+	parent, _ := coveringRule(node, kind)
+	return parent != nil
+}
+
+// Whether a rule is covered by another rule on its own hostname
+func coveredOnNode(node *trieNode, kind uint8) bool {
+	parent, _ := coveringRule(node, kind)
+	return parent == node
+}
+
+// Only the $important modifier keeps the rule safe to compress
+func onlyImportant(props ruleUtils.AdblockRule) bool {
+	if len(props.Options) != 1 {
+		return false
 	}
-	return domains
+	return props.Options[0].Name == "important" && props.Options[0].Value == ""
 }
 
 func toAdblockRules(ruleText string) []BlocklistRule {
@@ -52,15 +164,26 @@ func toAdblockRules(ruleText string) []BlocklistRule {
 	}
 
 	props := ruleUtils.LoadAdblockRuleProperties(ruleText)
-	if props.Hostname != "" && !props.Whitelist && len(props.Options) == 0 {
-		adblockRules = append(adblockRules, BlocklistRule{
-			RuleText:         ruleText,
-			CanCompress:      true,
-			Hostname:         props.Hostname,
-			OriginalRuleText: ruleText,
-		})
+	if !props.Whitelist && (len(props.Options) == 0 || onlyImportant(props)) {
+		var hostname string = props.Hostname
+		var wildcard bool = false
+		if matches := wildcardHostnameRegex.FindStringSubmatch(props.Pattern); len(matches) > 1 {
+			hostname = matches[1]
+			wildcard = true
+		}
 
-		return adblockRules
+		if hostname != "" {
+			adblockRules = append(adblockRules, BlocklistRule{
+				RuleText:         ruleText,
+				CanCompress:      true,
+				Hostname:         hostname,
+				OriginalRuleText: ruleText,
+				Wildcard:         wildcard,
+				Important:        len(props.Options) > 0,
+			})
+
+			return adblockRules
+		}
 	}
 
 	// Cannot parse or compress
@@ -74,69 +197,231 @@ func toAdblockRules(ruleText string) []BlocklistRule {
 	return adblockRules
 }
 
+type compressedRule struct {
+	ruleText string
+	// nil for the rules that cannot be compressed
+	node *trieNode
+	kind uint8
+}
+
 /**
- * This transformation compresses the final list by removing redundant rules.
- * Please note, that it also converts /etc/hosts rules into adblock-style rules.
- * 1. It converts all rules to adblock-style rules. For instance,
- * "0.0.0.0 example.org" will be converted to "||example.org^".
- * 2. It discards the rules that are already covered by existing rules.
- * For instance, "||example.org" blocks "example.org" and all it's subdomains,
- * therefore you don't need additional rules for the subdomains.
+ * Stream compresses the rules as they are read.
+ *
+ * Process only fills the trie and never returns anything,
+ * the compressed list is returned by Flush once all rules were seen.
+ * Every rule that is not a duplicate, compressible or not, is held until
+ * then so that the list keeps its order.
  */
-func Compress(rules []string) []string {
-	// var initialLength int = len(rules)
+type Stream struct {
+	root     *trieNode
+	filtered []compressedRule
+	// The rules covered by a rule on a parent domain are kept
+	keepSubdomains bool
+}
+
+func NewStream() *Stream {
+	return &Stream{root: &trieNode{}}
+}
+
+/**
+ * Returns a stream for the lists written as hosts files. A hosts line
+ * only blocks its own hostname, so the rules on the subdomains of a
+ * blocked hostname are kept, only the rules covered on their own
+ * hostname are removed.
+ */
+func NewSubdomainsStream() *Stream {
+	return &Stream{root: &trieNode{}, keepSubdomains: true}
+}
 
-	var byHostname map[string]bool = make(map[string]bool)
-	var filtered []BlocklistRule
+func (s *Stream) Name() string {
+	return "compress"
+}
 
-	// First loop:
-	// 1. Transform /etc/hosts rules to adblock-style rules
-	// 2. Fill "byHostname" lookup table
-	// 3. Check "byHostname" to eliminate duplicates on the first run
+// First loop:
+// 1. Transform /etc/hosts rules to adblock-style rules
+// 2. Store the hostnames in the trie
+// 3. Check the trie to eliminate duplicates on the first run
+func (s *Stream) Process(rules []string) []string {
 	for _, rule := range rules {
 		var adblockRules []BlocklistRule = toAdblockRules(rule)
 		for _, adblockRule := range adblockRules {
-			if adblockRule.CanCompress {
-				if _, exists := byHostname[adblockRule.Hostname]; !exists {
-					filtered = append(filtered, adblockRule)
-					byHostname[adblockRule.Hostname] = true
-				}
-			} else {
-				filtered = append(filtered, adblockRule)
+			if !adblockRule.CanCompress {
+				s.filtered = append(s.filtered, compressedRule{ruleText: adblockRule.RuleText})
+				continue
+			}
+
+			var node *trieNode = s.root.insert(adblockRule.Hostname)
+			var kind uint8 = ruleKind(adblockRule)
+			if node.kinds&kind == 0 {
+				node.kinds |= kind
+				s.filtered = append(s.filtered, compressedRule{ruleText: adblockRule.RuleText, node: node, kind: kind})
 			}
 		}
 	}
+	return nil
+}
+
+// Second loop:
+// Walk up from every hostname and discard the rule
+// if it's already covered by an existing rule.
+func (s *Stream) Flush() []string {
+	var compressedList []string = make([]string, 0, len(s.filtered))
+	var isCovered func(node *trieNode, kind uint8) bool = covered
+	if s.keepSubdomains {
+		isCovered = coveredOnNode
+	}
+	for _, rule := range s.filtered {
+		if rule.node == nil || !isCovered(rule.node, rule.kind) {
+			compressedList = append(compressedList, rule.ruleText)
+		}
+	}
+
+	s.root = &trieNode{}
+	s.filtered = nil
+	return compressedList
+}
+
+/**
+ * Redundancy is a rule that compress would remove because the rule at
+ * CoveredBy already blocks Hostname. Both are indexes in the list.
+ */
+type Redundancy struct {
+	Rule      int
+	CoveredBy int
+	Hostname  string
+}
+
+/**
+ * Finds the rules that are made redundant by other rules of the list,
+ * in the order of the list. A rule repeated with the same hostname is
+ * covered by its first occurrence.
+ */
+func Redundant(rules []string) []Redundancy {
+	type ruleKey struct {
+		node *trieNode
+		kind uint8
+	}
+	type indexedRule struct {
+		ruleKey
+		index    int
+		hostname string
+	}
+
+	var root *trieNode = &trieNode{}
+	var firstIndex map[ruleKey]int = make(map[ruleKey]int)
+	var unique []indexedRule
+	var redundant []Redundancy
+
+	for i, ruleText := range rules {
+		if ruleUtils.IsComment(ruleText) || len(strings.TrimSpace(ruleText)) == 0 {
+			continue
+		}
 
-	// Second loop:
-	// 1. Extract all hostnames up to TLD+1
-	// 2. Check them against "byHostname" and discard the rule
-	// if it's already covered by an existing rule.
-	for i := len(filtered) - 1; i >= 0; i -= 1 {
-		var rule BlocklistRule = filtered[i]
-		var discard bool = false
+		for _, adblockRule := range toAdblockRules(ruleText) {
+			if !adblockRule.CanCompress {
+				continue
+			}
 
-		if rule.CanCompress {
-			var hostnames []string = extractHostnames(rule.Hostname)
-			// Start iterating from 1 -- don't check the full hostname
-			for j := 1; j < len(hostnames); j += 1 {
-				var hostname string = hostnames[j]
-				if byHostname[hostname] {
-					discard = true
-					break
+			var key ruleKey = ruleKey{node: root.insert(adblockRule.Hostname), kind: ruleKind(adblockRule)}
+			if first, exists := firstIndex[key]; exists {
+				if first != i {
+					redundant = append(redundant, Redundancy{Rule: i, CoveredBy: first, Hostname: adblockRule.Hostname})
 				}
+				continue
+			}
+
+			key.node.kinds |= key.kind
+			firstIndex[key] = i
+			unique = append(unique, indexedRule{ruleKey: key, index: i, hostname: adblockRule.Hostname})
+		}
+	}
+
+	for _, rule := range unique {
+		if node, kind := coveringRule(rule.node, rule.kind); node != nil {
+			redundant = append(redundant, Redundancy{Rule: rule.index, CoveredBy: firstIndex[ruleKey{node: node, kind: kind}], Hostname: rule.hostname})
+		}
+	}
+
+	sort.SliceStable(redundant, func(i, j int) bool {
+		return redundant[i].Rule < redundant[j].Rule
+	})
+	return redundant
+}
+
+/**
+ * Index tells whether hostnames are blocked by a list of rules,
+ * taking the rules on parent domains into account.
+ */
+type Index struct {
+	root *trieNode
+}
+
+func NewIndex(rules []string) *Index {
+	var index *Index = &Index{root: &trieNode{}}
+	for _, ruleText := range rules {
+		if ruleUtils.IsComment(ruleText) || len(strings.TrimSpace(ruleText)) == 0 {
+			continue
+		}
+		for _, adblockRule := range toAdblockRules(ruleText) {
+			if adblockRule.CanCompress {
+				var node *trieNode = index.root.insert(adblockRule.Hostname)
+				node.kinds |= ruleKind(adblockRule)
 			}
 		}
+	}
+	return index
+}
 
-		if discard {
-			filtered = append(filtered[:i], filtered[i+1:]...)
+func (index *Index) Blocks(hostname string) bool {
+	var node *trieNode = index.root
+	for len(hostname) > 0 {
+		var dot int = strings.LastIndexByte(hostname, '.')
+		child, exists := node.children[hostname[dot+1:]]
+		if !exists {
+			return false
+		}
+		node = child
+		if dot == -1 {
+			break
 		}
+		if node.kinds != 0 {
+			// A parent domain is blocked
+			return true
+		}
+		hostname = hostname[:dot]
 	}
+	return node != index.root && node.kinds&(blocksHostname|blocksHostnameImportant) != 0
+}
 
-	compressedList := make([]string, len(filtered))
-	for i, rule := range filtered {
-		compressedList[i] = rule.RuleText
+// Hostnames of the rules that can be compressed, in the order of the list
+func Hostnames(rules []string) []string {
+	var hostnames []string
+	for _, ruleText := range rules {
+		if ruleUtils.IsComment(ruleText) || len(strings.TrimSpace(ruleText)) == 0 {
+			continue
+		}
+		for _, adblockRule := range toAdblockRules(ruleText) {
+			if adblockRule.CanCompress {
+				hostnames = append(hostnames, adblockRule.Hostname)
+			}
+		}
 	}
+	return hostnames
+}
 
-	fmt.Printf("compress - start: %d\tend: %d\n", len(rules), len(compressedList))
-	return compressedList
+/**
+ * This transformation compresses the final list by removing redundant rules.
+ * Please note, that it also converts /etc/hosts rules into adblock-style rules.
+ * 1. It converts all rules to adblock-style rules. For instance,
+ * "0.0.0.0 example.org" will be converted to "||example.org^".
+ * 2. It discards the rules that are already covered by existing rules.
+ * For instance, "||example.org" blocks "example.org" and all it's subdomains,
+ * therefore you don't need additional rules for the subdomains.
+ * "||*.example.org^" blocks the subdomains only and rules with nothing
+ * but the $important modifier are compressed against each other.
+ */
+func Compress(rules []string) []string {
+	var stream *Stream = NewStream()
+	stream.Process(rules)
+	return stream.Flush()
 }
@@ -0,0 +1,118 @@
+package compress
+
+import (
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"empty", nil, []string{}},
+		{"hosts rule", []string{"0.0.0.0 example.org"}, []string{"||example.org^"}},
+		{"hosts rule with many hostnames", []string{"0.0.0.0 a.org b.org"}, []string{"||a.org^", "||b.org^"}},
+		{"plain domain", []string{"example.org"}, []string{"||example.org^"}},
+		{"duplicate", []string{"example.org", "||example.org^"}, []string{"||example.org^"}},
+		{"subdomain before parent", []string{"||a.example.org^", "||example.org^"}, []string{"||example.org^"}},
+		{"subdomain after parent", []string{"||example.org^", "||a.example.org^"}, []string{"||example.org^"}},
+		{"sibling", []string{"||a.example.org^", "||b.example.org^"}, []string{"||a.example.org^", "||b.example.org^"}},
+		{"allowlist is kept", []string{"||example.org^", "@@||a.example.org^"}, []string{"||example.org^", "@@||a.example.org^"}},
+		{"modifiers are kept", []string{"||example.org^", "||a.example.org^$third-party"}, []string{"||example.org^", "||a.example.org^$third-party"}},
+		{"wildcard covers subdomains", []string{"||*.example.org^", "||a.example.org^"}, []string{"||*.example.org^"}},
+		{"wildcard does not cover hostname", []string{"||*.example.org^", "||example.org^"}, []string{"||example.org^"}},
+		{"important covers plain", []string{"||example.org^", "||example.org^$important"}, []string{"||example.org^$important"}},
+		{"plain does not cover important", []string{"||example.org^", "||a.example.org^$important"}, []string{"||example.org^", "||a.example.org^$important"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compress(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubdomainsStream(t *testing.T) {
+	var stream *Stream = NewSubdomainsStream()
+	stream.Process([]string{"||example.org^", "||ads.example.org^", "0.0.0.0 ads.example.org", "||example.org^$important", "||*.example.org^"})
+	if got, want := stream.Flush(), []string{"||ads.example.org^", "||example.org^$important"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Flush() = %q, want %q", got, want)
+	}
+}
+
+func TestCompressGolden(t *testing.T) {
+	testutils.Golden(t, *update, Compress)
+}
+
+func BenchmarkCompress(b *testing.B) {
+	// Compress runs after the comments were removed
+	var rules []string
+	for _, rule := range testutils.GenerateCorpus(2_000_000) {
+		if !ruleUtils.IsComment(rule) {
+			rules = append(rules, rule)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		Compress(rules)
+	}
+}
+
+func TestRedundant(t *testing.T) {
+	var rules []string = []string{
+		"! comment",
+		"||example.org^",
+		"||ads.example.org^",
+		"0.0.0.0 example.org other.net",
+		"||other.net^$important",
+		"||example.org^",
+		"||*.other.net^",
+	}
+	var want []Redundancy = []Redundancy{
+		{Rule: 2, CoveredBy: 1, Hostname: "ads.example.org"},
+		{Rule: 3, CoveredBy: 1, Hostname: "example.org"},
+		{Rule: 3, CoveredBy: 4, Hostname: "other.net"},
+		{Rule: 5, CoveredBy: 1, Hostname: "example.org"},
+		{Rule: 6, CoveredBy: 3, Hostname: "other.net"},
+	}
+
+	if got := Redundant(rules); !reflect.DeepEqual(got, want) {
+		t.Errorf("Redundant() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIndexBlocks(t *testing.T) {
+	var index *Index = NewIndex([]string{"||example.org^", "||*.wild.org^", "0.0.0.0 hosts.net", "@@||allowed.org^"})
+
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{"example.org", true},
+		{"ads.example.org", true},
+		{"org", false},
+		{"wild.org", false},
+		{"a.wild.org", true},
+		{"hosts.net", true},
+		{"allowed.org", false},
+		{"other.org", false},
+	}
+
+	for _, tt := range tests {
+		if got := index.Blocks(tt.hostname); got != tt.want {
+			t.Errorf("Blocks(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
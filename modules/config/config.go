@@ -0,0 +1,516 @@
+package config
+
+import (
+	"dns-hostlist-compiler/modules/format"
+	"dns-hostlist-compiler/modules/schedule"
+	"dns-hostlist-compiler/modules/transform"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Source struct {
+	Name string `json:"name"`
+	// URL or path of the list
+	Source string `json:"source"`
+	// Extra HTTP request headers, also sent for the included files
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    *Auth             `json:"auth,omitempty"`
+	// Hex SHA-256 of the content of the source, after decompression.
+	// The files it includes are not covered.
+	SHA256 string  `json:"sha256,omitempty"`
+	Limits *Limits `json:"limits,omitempty"`
+	Guard  *Guard  `json:"guard,omitempty"`
+}
+
+/**
+ * Guard catches a broken upstream before it is published: a source or a
+ * list with too few rules, or whose number of rules changed too much
+ * since the previous build.
+ */
+type Guard struct {
+	MinRules int `json:"minRules,omitempty"`
+	// Largest change of the number of rules since the previous build,
+	// in percent of the previous build. 0 is no limit.
+	MaxChangePercent float64 `json:"maxChangePercent,omitempty"`
+}
+
+// What a build breaching a guard does
+const (
+	GUARD_FAIL = "fail"
+	GUARD_KEEP = "keep"
+)
+
+// Guard of the compiled list
+type ListGuard struct {
+	Guard
+	// GUARD_FAIL (default) fails the build, GUARD_KEEP leaves the previous
+	// output in place
+	OnBreach string `json:"onBreach,omitempty"`
+}
+
+// What a source or the build exceeding one of its limits does
+const (
+	LIMIT_ERROR    = "error"
+	LIMIT_TRUNCATE = "truncate"
+)
+
+/**
+ * Limits of a source, counting the files it includes, or of the whole
+ * build. Bytes are counted after decompression, lines are the lines of
+ * the files and rules the lines that are not comments. 0 is no limit.
+ */
+type Limits struct {
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	MaxLines int64 `json:"maxLines,omitempty"`
+	MaxRules int64 `json:"maxRules,omitempty"`
+	// LIMIT_ERROR (default) or LIMIT_TRUNCATE, which keeps what was read
+	// up to the limit
+	OnExceed string `json:"onExceed,omitempty"`
+}
+
+const (
+	AUTH_BASIC  = "basic"
+	AUTH_BEARER = "bearer"
+)
+
+/**
+ * Auth sets the Authorization header of the requests for a source.
+ * The password or token is never written in the config, it is read from
+ * the environment variable Env or from File.
+ */
+type Auth struct {
+	// "basic" or "bearer"
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Env      string `json:"env,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// What to do when a source does not match its sha256
+const (
+	INTEGRITY_FAIL = "fail"
+	INTEGRITY_WARN = "warn"
+)
+
+/**
+ * Output is a file the compiled list is written to. Every output is
+ * rendered from the same build, the header settings default to those of
+ * the list.
+ */
+type Output struct {
+	Path string `json:"path"`
+	// One of format.FORMATS, compile --format (adblock by default) when empty
+	Format   string `json:"format,omitempty"`
+	Header   *bool  `json:"header,omitempty"`
+	Checksum *bool  `json:"checksum,omitempty"`
+	Gzip     bool   `json:"gzip,omitempty"`
+	// Names from transform.TRANSFORMATIONS, run in order before rendering
+	Transformations []string `json:"transformations,omitempty"`
+}
+
+/**
+ * List is one of several lists built from a single config. A source with
+ * a name and no "source" is the source of the config with that name, so
+ * the lists can share their sources. The settings a list leaves empty
+ * are those of the config.
+ */
+type List struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Homepage    string `json:"homepage,omitempty"`
+	License     string `json:"license,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Expires     string `json:"expires,omitempty"`
+	Header      *bool  `json:"header,omitempty"`
+	Checksum    *bool  `json:"checksum,omitempty"`
+	// Limits of the build of the list
+	Limits          *Limits    `json:"limits,omitempty"`
+	Guard           *ListGuard `json:"guard,omitempty"`
+	Transformations []string   `json:"transformations,omitempty"`
+	Schedule        string     `json:"schedule,omitempty"`
+	Outputs         []Output   `json:"outputs"`
+	Sources         []Source   `json:"sources"`
+}
+
+// Settings of the HTTP client used for every source
+type HTTP struct {
+	UserAgent string `json:"userAgent,omitempty"`
+	// Proxy URL, the HTTP_PROXY and HTTPS_PROXY variables are used when empty
+	Proxy string `json:"proxy,omitempty"`
+	// PEM file with the certificates trusted in addition to the system ones
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+/**
+ * Compiler configuration, read from a JSON file such as:
+ *
+ *	{
+ *	  "name": "My list",
+ *	  "description": "Ads and trackers",
+ *	  "homepage": "https://example.org",
+ *	  "license": "GPL-3.0",
+ *	  "version": "1.0.0",
+ *	  "expires": "1 day",
+ *	  "header": true,
+ *	  "checksum": true,
+ *	  "http": {"userAgent": "my-compiler/1.0", "proxy": "http://proxy:3128", "caBundle": "ca.pem"},
+ *	  "integrity": "warn",
+ *	  "limits": {"maxBytes": 104857600, "onExceed": "error"},
+ *	  "guard": {"minRules": 10000, "maxChangePercent": 30, "onBreach": "keep"},
+ *	  "transformations": ["removeregexrules"],
+ *	  "schedule": "30 4 * * *",
+ *	  "outputs": [
+ *	    {"path": "adguard.txt"},
+ *	    {"path": "hosts.txt", "format": "hosts", "header": false, "transformations": ["sort"]},
+ *	    {"path": "dnsmasq.conf.gz", "format": "dnsmasq", "gzip": true}
+ *	  ],
+ *	  "sources": [
+ *	    {"name": "AdGuard DNS filter", "source": "https://example.org/filter.txt",
+ *	     "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+ *	     "limits": {"maxLines": 500000, "onExceed": "truncate"},
+ *	     "guard": {"minRules": 1000}},
+ *	    {"name": "Internal", "source": "https://lists.internal/ads.txt",
+ *	     "headers": {"X-Team": "dns"}, "auth": {"type": "bearer", "env": "LISTS_TOKEN"}}
+ *	  ]
+ *	}
+ *
+ * or, for several lists sharing their sources:
+ *
+ *	{
+ *	  "header": true,
+ *	  "sources": [{"name": "AdGuard DNS filter", "source": "https://example.org/filter.txt"}],
+ *	  "lists": [
+ *	    {"name": "Ads", "outputs": [{"path": "ads.txt"}],
+ *	     "sources": [{"name": "AdGuard DNS filter"}, {"name": "Extra", "source": "extra.txt"}]},
+ *	    {"name": "Family", "schedule": "@every 30m", "outputs": [{"path": "family.txt"}],
+ *	     "sources": [{"name": "AdGuard DNS filter"}, {"name": "Adult", "source": "adult.txt"}]}
+ *	  ]
+ *	}
+ */
+type Config struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Homepage    string `json:"homepage"`
+	License     string `json:"license"`
+	Version     string `json:"version"`
+	Expires     string `json:"expires"`
+	// Write the metadata header at the top of the output
+	Header bool `json:"header"`
+	// Add a "! Checksum:" line to the header
+	Checksum bool `json:"checksum"`
+	HTTP     HTTP `json:"http"`
+	// INTEGRITY_FAIL (default) or INTEGRITY_WARN
+	Integrity string `json:"integrity,omitempty"`
+	// Limits of the whole build, the sources have their own
+	Limits Limits    `json:"limits,omitempty"`
+	Guard  ListGuard `json:"guard,omitempty"`
+	// Names from transform.TRANSFORMATIONS, run on the compiled rules
+	// before the outputs
+	Transformations []string `json:"transformations,omitempty"`
+	// When the daemon builds the list, see schedule.Parse
+	Schedule string `json:"schedule,omitempty"`
+	// Files written by compile, the --output file when empty
+	Outputs []Output `json:"outputs,omitempty"`
+	// The sources of the list, or those the lists refer to by name
+	Sources []Source `json:"sources"`
+	// Lists built instead of the config itself, see ListConfigs
+	Lists []List `json:"lists,omitempty"`
+}
+
+func Load(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (cfg Config) Validate() error {
+	if len(cfg.Lists) > 0 {
+		return cfg.validateLists()
+	}
+	if len(cfg.Sources) == 0 {
+		return fmt.Errorf("no sources")
+	}
+	if cfg.Integrity != "" && cfg.Integrity != INTEGRITY_FAIL && cfg.Integrity != INTEGRITY_WARN {
+		return fmt.Errorf("unknown integrity mode %q, expected %s or %s", cfg.Integrity, INTEGRITY_FAIL, INTEGRITY_WARN)
+	}
+	if err := cfg.Limits.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Guard.Validate(); err != nil {
+		return err
+	}
+	if cfg.Guard.OnBreach != "" && cfg.Guard.OnBreach != GUARD_FAIL && cfg.Guard.OnBreach != GUARD_KEEP {
+		return fmt.Errorf("unknown onBreach %q, expected %s or %s", cfg.Guard.OnBreach, GUARD_FAIL, GUARD_KEEP)
+	}
+	if err := transform.Validate(cfg.Transformations); err != nil {
+		return err
+	}
+	if cfg.Schedule != "" {
+		if _, err := schedule.Parse(cfg.Schedule); err != nil {
+			return err
+		}
+	}
+	var paths map[string]bool = make(map[string]bool)
+	for i, output := range cfg.Outputs {
+		if err := output.Validate(); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+		if paths[filepath.Clean(output.Path)] {
+			return fmt.Errorf("output %d: %s is written by another output", i, output.Path)
+		}
+		paths[filepath.Clean(output.Path)] = true
+	}
+	for i, source := range cfg.Sources {
+		if source.Source == "" {
+			return fmt.Errorf("source %d has no \"source\"", i)
+		}
+		for name := range source.Headers {
+			if strings.EqualFold(name, "Authorization") {
+				return fmt.Errorf("source %d: set the Authorization header with \"auth\", secrets do not belong in the config", i)
+			}
+		}
+		if source.Auth != nil {
+			if err := source.Auth.Validate(); err != nil {
+				return fmt.Errorf("source %d: %w", i, err)
+			}
+		}
+		if source.SHA256 != "" && !isSHA256(source.SHA256) {
+			return fmt.Errorf("source %d: sha256 must be 64 hexadecimal characters", i)
+		}
+		if source.Limits != nil {
+			if err := source.Limits.Validate(); err != nil {
+				return fmt.Errorf("source %d: %w", i, err)
+			}
+		}
+		if source.Guard != nil {
+			if err := source.Guard.Validate(); err != nil {
+				return fmt.Errorf("source %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg Config) validateLists() error {
+	if len(cfg.Outputs) > 0 {
+		return fmt.Errorf("with lists, the outputs belong to the lists")
+	}
+	var names map[string]bool = make(map[string]bool)
+	var paths map[string]string = make(map[string]string)
+	for i, list := range cfg.Lists {
+		if list.Name == "" {
+			return fmt.Errorf("list %d has no \"name\"", i)
+		}
+		if names[list.Name] {
+			return fmt.Errorf("list %q is defined twice", list.Name)
+		}
+		names[list.Name] = true
+		if len(list.Outputs) == 0 {
+			return fmt.Errorf("list %q has no outputs", list.Name)
+		}
+		for _, output := range list.Outputs {
+			if other, found := paths[filepath.Clean(output.Path)]; found {
+				return fmt.Errorf("list %q: %s is written by the list %q", list.Name, output.Path, other)
+			}
+			paths[filepath.Clean(output.Path)] = list.Name
+		}
+
+		for j, source := range list.Sources {
+			if source.Source == "" && !cfg.hasSource(source.Name) {
+				return fmt.Errorf("list %q: source %d is neither a \"source\" nor the name of a source of the config", list.Name, j)
+			}
+		}
+		if err := cfg.ListConfig(list).Validate(); err != nil {
+			return fmt.Errorf("list %q: %w", list.Name, err)
+		}
+	}
+	return nil
+}
+
+func (cfg Config) hasSource(name string) bool {
+	for _, source := range cfg.Sources {
+		if name != "" && source.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * The config a list is compiled with: its settings, or those of the
+ * config it leaves empty, and its sources with those referred to by
+ * name replaced by the sources of the config.
+ */
+func (cfg Config) ListConfig(list List) Config {
+	var listCfg Config = cfg
+	listCfg.Lists = nil
+	listCfg.Name = list.Name
+	listCfg.Outputs = list.Outputs
+	if list.Description != "" {
+		listCfg.Description = list.Description
+	}
+	if list.Homepage != "" {
+		listCfg.Homepage = list.Homepage
+	}
+	if list.License != "" {
+		listCfg.License = list.License
+	}
+	if list.Version != "" {
+		listCfg.Version = list.Version
+	}
+	if list.Expires != "" {
+		listCfg.Expires = list.Expires
+	}
+	if list.Header != nil {
+		listCfg.Header = *list.Header
+	}
+	if list.Checksum != nil {
+		listCfg.Checksum = *list.Checksum
+	}
+	if list.Limits != nil {
+		listCfg.Limits = *list.Limits
+	}
+	if list.Guard != nil {
+		listCfg.Guard = *list.Guard
+	}
+	if len(list.Transformations) > 0 {
+		listCfg.Transformations = list.Transformations
+	}
+	if list.Schedule != "" {
+		listCfg.Schedule = list.Schedule
+	}
+
+	listCfg.Sources = nil
+	for _, source := range list.Sources {
+		if source.Source == "" {
+			for _, shared := range cfg.Sources {
+				if shared.Name == source.Name {
+					source = shared
+					break
+				}
+			}
+		}
+		listCfg.Sources = append(listCfg.Sources, source)
+	}
+	return listCfg
+}
+
+// The configs of the lists, in order
+func (cfg Config) ListConfigs() []Config {
+	var configs []Config
+	for _, list := range cfg.Lists {
+		configs = append(configs, cfg.ListConfig(list))
+	}
+	return configs
+}
+
+/**
+ * The sources of the config and of its lists, once each: the tools
+ * reading every source, such as lock and stats, use them. Sources with
+ * the same URL but other headers, auth, sha256, limits or guard are
+ * different sources.
+ */
+func (cfg Config) AllSources() []Source {
+	var sources []Source
+	var seen map[string]bool = make(map[string]bool)
+	var add = func(source Source) {
+		var key string = source.Source
+		if definition, err := json.Marshal(source); err == nil {
+			key = string(definition)
+		}
+		if !seen[key] {
+			seen[key] = true
+			sources = append(sources, source)
+		}
+	}
+
+	for _, source := range cfg.Sources {
+		add(source)
+	}
+	for _, listCfg := range cfg.ListConfigs() {
+		for _, source := range listCfg.Sources {
+			add(source)
+		}
+	}
+	return sources
+}
+
+func (auth Auth) Validate() error {
+	switch auth.Type {
+	case AUTH_BASIC:
+		if auth.Username == "" {
+			return fmt.Errorf("basic auth without a username")
+		}
+	case AUTH_BEARER:
+	default:
+		return fmt.Errorf("unknown auth type %q, expected %s or %s", auth.Type, AUTH_BASIC, AUTH_BEARER)
+	}
+
+	if (auth.Env == "") == (auth.File == "") {
+		return fmt.Errorf("%s auth needs exactly one of \"env\" or \"file\" for the secret", auth.Type)
+	}
+	return nil
+}
+
+func (limits Limits) Validate() error {
+	if limits.MaxBytes < 0 || limits.MaxLines < 0 || limits.MaxRules < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	if limits.OnExceed != "" && limits.OnExceed != LIMIT_ERROR && limits.OnExceed != LIMIT_TRUNCATE {
+		return fmt.Errorf("unknown onExceed %q, expected %s or %s", limits.OnExceed, LIMIT_ERROR, LIMIT_TRUNCATE)
+	}
+	return nil
+}
+
+func (output Output) Validate() error {
+	if output.Path == "" {
+		return fmt.Errorf("no \"path\"")
+	}
+	if output.Format != "" {
+		if err := format.Validate(output.Format); err != nil {
+			return err
+		}
+	}
+	return transform.Validate(output.Transformations)
+}
+
+func (guard Guard) Validate() error {
+	if guard.MinRules < 0 || guard.MaxChangePercent < 0 {
+		return fmt.Errorf("guard thresholds cannot be negative")
+	}
+	return nil
+}
+
+func isSHA256(digest string) bool {
+	if len(digest) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+/**
+ * Makes sources out of plain links, named after the link itself.
+ */
+func SourcesFromLinks(links []string) []Source {
+	var sources []Source
+	for _, link := range links {
+		sources = append(sources, Source{Name: link, Source: link})
+	}
+	return sources
+}
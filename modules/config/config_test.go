@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	var path string = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{"name": "Test", "header": true, "sources": [{"name": "First", "source": "first.txt"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "Test" || !cfg.Header || len(cfg.Sources) != 1 || cfg.Sources[0].Source != "first.txt" {
+		t.Errorf("Load() = %+v", cfg)
+	}
+}
+
+func TestLoadSourceAuth(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{
+		"http": {"userAgent": "test/1.0", "proxy": "http://proxy:3128"},
+		"sources": [{"source": "https://example.org/list.txt", "headers": {"X-Team": "dns"}, "auth": {"type": "basic", "username": "user", "file": "password"}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var source Source = cfg.Sources[0]
+	if cfg.HTTP.UserAgent != "test/1.0" || source.Headers["X-Team"] != "dns" || source.Auth == nil || source.Auth.Username != "user" || source.Auth.File != "password" {
+		t.Errorf("Load() = %+v, source %+v", cfg, source)
+	}
+}
+
+func TestLoadGuard(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{"guard": {"minRules": 100, "maxChangePercent": 25.5, "onBreach": "keep"}, "sources": [{"source": "a.txt", "guard": {"minRules": 10}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Guard.MinRules != 100 || cfg.Guard.MaxChangePercent != 25.5 || cfg.Guard.OnBreach != GUARD_KEEP || cfg.Sources[0].Guard.MinRules != 10 {
+		t.Errorf("Load() = %+v", cfg)
+	}
+}
+
+func TestLoadLists(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `{
+		"description": "Lists of the team", "license": "MIT", "header": true, "transformations": ["sort"],
+		"sources": [{"name": "Shared", "source": "https://example.org/shared.txt", "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}],
+		"lists": [
+			{"name": "Ads", "description": "Ads only", "outputs": [{"path": "ads.txt"}], "sources": [{"name": "Shared"}, {"name": "Ads", "source": "ads.txt"}]},
+			{"name": "Family", "header": false, "schedule": "@daily", "transformations": ["removeregexrules"], "outputs": [{"path": "family.txt"}], "sources": [{"name": "Shared"}, {"name": "Ads", "source": "ads.txt", "headers": {"X-List": "family"}}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lists []Config = cfg.ListConfigs()
+	if len(lists) != 2 {
+		t.Fatalf("ListConfigs() = %+v", lists)
+	}
+	var ads Config = lists[0]
+	if ads.Name != "Ads" || ads.Description != "Ads only" || ads.License != "MIT" || !ads.Header || len(ads.Sources) != 2 || ads.Sources[0].SHA256 != cfg.Sources[0].SHA256 || ads.Transformations[0] != "sort" || ads.Lists != nil {
+		t.Errorf("ListConfigs()[0] = %+v", ads)
+	}
+	var family Config = lists[1]
+	if family.Header || family.Description != "Lists of the team" || family.Transformations[0] != "removeregexrules" || family.Outputs[0].Path != "family.txt" || family.Schedule != "@daily" {
+		t.Errorf("ListConfigs()[1] = %+v", family)
+	}
+
+	// The same URL with other headers is another source
+	if sources := cfg.AllSources(); len(sources) != 3 || sources[1].Source != "ads.txt" || sources[2].Headers["X-List"] != "family" {
+		t.Errorf("AllSources() = %+v", sources)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{`, "invalid config"},
+		{`{"sources": []}`, "no sources"},
+		{`{"sources": [{"name": "First"}]}`, "has no \"source\""},
+		{`{"sources": [{"source": "a.txt", "headers": {"authorization": "Bearer x"}}]}`, "secrets do not belong in the config"},
+		{`{"sources": [{"source": "a.txt", "auth": {"type": "digest", "env": "TOKEN"}}]}`, "unknown auth type"},
+		{`{"sources": [{"source": "a.txt", "auth": {"type": "basic", "env": "PASSWORD"}}]}`, "without a username"},
+		{`{"sources": [{"source": "a.txt", "auth": {"type": "bearer"}}]}`, "exactly one of"},
+		{`{"sources": [{"source": "a.txt", "auth": {"type": "bearer", "env": "TOKEN", "file": "token"}}]}`, "exactly one of"},
+		{`{"sources": [{"source": "a.txt", "sha256": "abc"}]}`, "64 hexadecimal characters"},
+		{`{"integrity": "ignore", "sources": [{"source": "a.txt"}]}`, "unknown integrity mode"},
+		{`{"limits": {"maxBytes": -1}, "sources": [{"source": "a.txt"}]}`, "cannot be negative"},
+		{`{"sources": [{"source": "a.txt", "limits": {"onExceed": "drop"}}]}`, "source 0: unknown onExceed"},
+		{`{"outputs": [{"format": "hosts"}], "sources": [{"source": "a.txt"}]}`, "output 0: no \"path\""},
+		{`{"outputs": [{"path": "a.conf", "format": "unbound"}], "sources": [{"source": "a.txt"}]}`, "output 0: unknown format"},
+		{`{"outputs": [{"path": "a.txt", "transformations": ["invert"]}], "sources": [{"source": "a.txt"}]}`, "unknown transformation"},
+		{`{"outputs": [{"path": "out/a.txt"}, {"path": "out//a.txt", "format": "hosts"}], "sources": [{"source": "a.txt"}]}`, "output 1: out//a.txt is written by another output"},
+		{`{"guard": {"onBreach": "ignore"}, "sources": [{"source": "a.txt"}]}`, "unknown onBreach"},
+		{`{"sources": [{"source": "a.txt", "guard": {"maxChangePercent": -5}}]}`, "source 0: guard thresholds cannot be negative"},
+		{`{"transformations": ["invert"], "sources": [{"source": "a.txt"}]}`, "unknown transformation"},
+		{`{"schedule": "every day", "sources": [{"source": "a.txt"}]}`, "invalid schedule"},
+		{`{"lists": [{"name": "Ads", "schedule": "* * *", "outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt"}]}]}`, "list \"Ads\": invalid schedule"},
+		{`{"lists": [{"outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt"}]}]}`, "list 0 has no \"name\""},
+		{`{"lists": [{"name": "Ads", "sources": [{"source": "a.txt"}]}]}`, "list \"Ads\" has no outputs"},
+		{`{"lists": [{"name": "Ads", "outputs": [{"path": "a.txt"}], "sources": [{"name": "Shared"}]}]}`, "source 0 is neither"},
+		{`{"lists": [{"name": "Ads", "outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt"}]}, {"name": "Ads", "outputs": [{"path": "b.txt"}], "sources": [{"source": "b.txt"}]}]}`, "defined twice"},
+		{`{"lists": [{"name": "Ads", "outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt"}]}, {"name": "Malware", "outputs": [{"path": "./a.txt"}], "sources": [{"source": "b.txt"}]}]}`, "written by the list \"Ads\""},
+		{`{"outputs": [{"path": "all.txt"}], "lists": [{"name": "Ads", "outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt"}]}]}`, "outputs belong to the lists"},
+		{`{"lists": [{"name": "Ads", "outputs": [{"path": "a.txt"}], "sources": [{"source": "a.txt", "sha256": "abc"}]}]}`, "list \"Ads\": source 0: sha256"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Load(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%s) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Load() of a missing file error = nil")
+	}
+}
@@ -2,21 +2,27 @@ package deduplicate
 
 import (
 	"dns-hostlist-compiler/modules/ruleUtils"
-	"fmt"
 )
 
+/**
+ * Removes duplicate rules, keeping the last occurrence of every rule.
+ * Comments and empty lines preceding a removed rule are removed as well.
+ *
+ * The rules are marked in a single pass from the end of the list and
+ * copied into a new slice, the caller's slice is left untouched.
+ */
 func Deduplicate(rules []string) []string {
 	if len(rules) == 0 {
 		return rules
 	}
 
-	// Clone the original array before modifying it
-	var filtered []string = rules
+	var keep []bool = make([]bool, len(rules))
+	var kept int = 0
 	var prevRuleRemoved bool = false
-	var rulesIndex map[string]struct{} = make(map[string]struct{})
+	var rulesIndex map[string]struct{} = make(map[string]struct{}, len(rules))
 
-	for iFiltered := len(filtered) - 1; iFiltered >= 0; iFiltered -= 1 {
-		var ruleText string = filtered[iFiltered]
+	for i := len(rules) - 1; i >= 0; i -= 1 {
+		var ruleText string = rules[i]
 
 		_, exists := rulesIndex[ruleText]
 		if !exists {
@@ -25,16 +31,22 @@ func Deduplicate(rules []string) []string {
 
 		if exists && !ruleUtils.IsComment(ruleText) && len(ruleText) > 0 {
 			prevRuleRemoved = true
-			filtered = append(filtered[:iFiltered], filtered[iFiltered+1:]...)
 		} else if prevRuleRemoved && (ruleUtils.IsComment(ruleText) || len(ruleText) == 0) {
 			// Remove preceding comments and empty lines
-			filtered = append(filtered[:iFiltered], filtered[iFiltered+1:]...)
 		} else {
 			// Stop removing comments
 			prevRuleRemoved = false
+			keep[i] = true
+			kept += 1
+		}
+	}
+
+	var filtered []string = make([]string, 0, kept)
+	for i, ruleText := range rules {
+		if keep[i] {
+			filtered = append(filtered, ruleText)
 		}
 	}
 
-	fmt.Printf("deduplicate - start: %d\tend: %d\n", len(rules), len(filtered))
 	return filtered
 }
@@ -0,0 +1,57 @@
+package deduplicate
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestDeduplicate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"empty", []string{}, []string{}},
+		{"no duplicates", []string{"||a.org^", "||b.org^"}, []string{"||a.org^", "||b.org^"}},
+		{"keeps last occurrence", []string{"||a.org^", "||b.org^", "||a.org^"}, []string{"||b.org^", "||a.org^"}},
+		{"removes preceding comments", []string{"! a", "", "||a.org^", "||a.org^"}, []string{"||a.org^"}},
+		{"keeps duplicate comments", []string{"! a", "! a", "||a.org^"}, []string{"! a", "! a", "||a.org^"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Deduplicate(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Deduplicate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeduplicateDoesNotModifyInput(t *testing.T) {
+	var rules []string = []string{"||a.org^", "||b.org^", "||a.org^"}
+	var want []string = append([]string{}, rules...)
+
+	Deduplicate(rules)
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Deduplicate() modified its input: %q", rules)
+	}
+}
+
+func TestDeduplicateGolden(t *testing.T) {
+	testutils.Golden(t, *update, Deduplicate)
+}
+
+func BenchmarkDeduplicate(b *testing.B) {
+	var rules []string = testutils.GenerateCorpus(2_000_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		Deduplicate(rules)
+	}
+}
@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"dns-hostlist-compiler/modules/compress"
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/**
+ * Result lists the rules only one side has and the hostnames whose
+ * blocking changed. A hostname blocked through a parent domain counts as
+ * covered, so replacing ||ads.example.org^ with ||example.org^ adds and
+ * removes a rule but changes no coverage for ads.example.org. Allowlist
+ * rules are only added or removed, they are not part of the coverage.
+ */
+type Result struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Covered   []string `json:"newlyCovered"`
+	Uncovered []string `json:"uncovered"`
+}
+
+func (r Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0
+}
+
+/**
+ * Rewrites the rule the way the parser understands it so that both sides
+ * compare equal when they only differ in syntax:
+ * "0.0.0.0 a.org b.org" -> "||a.org^", "||b.org^"
+ * "example.org" -> "||example.org^"
+ * Comments and empty lines are dropped.
+ */
+func Normalize(ruleText string) []string {
+	ruleText = strings.TrimSpace(ruleText)
+	if ruleText == "" || ruleUtils.IsComment(ruleText) {
+		return nil
+	}
+
+	if ruleUtils.IsEtcHostsRule(ruleText) {
+		props, err := ruleUtils.LoadEtcHostsRuleProperties(ruleText)
+		if err != nil {
+			return []string{ruleText}
+		}
+		var rules []string
+		for _, hostname := range props.Hostnames {
+			rules = append(rules, fmt.Sprintf("||%s^", hostname))
+		}
+		return rules
+	}
+
+	if ruleUtils.IsJustDomain(ruleText) {
+		return []string{fmt.Sprintf("||%s^", ruleText)}
+	}
+
+	return []string{ruleUtils.AdblockRuleToString(ruleUtils.LoadAdblockRuleProperties(ruleText))}
+}
+
+// Normalized rules of the list without duplicates, in the order of the list
+func normalizeAll(lines []string) ([]string, map[string]struct{}) {
+	var rules []string
+	var seen map[string]struct{} = make(map[string]struct{})
+	for _, line := range lines {
+		for _, rule := range Normalize(line) {
+			if _, exists := seen[rule]; !exists {
+				seen[rule] = struct{}{}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, seen
+}
+
+// The rules that block hostnames, the allowlist rules are left out
+func blocking(rules []string) []string {
+	var blockingRules []string
+	for _, rule := range rules {
+		if !ruleUtils.LoadAdblockRuleProperties(rule).Whitelist {
+			blockingRules = append(blockingRules, rule)
+		}
+	}
+	return blockingRules
+}
+
+func missingFrom(rules []string, other map[string]struct{}) []string {
+	var missing []string = []string{}
+	for _, rule := range rules {
+		if _, exists := other[rule]; !exists {
+			missing = append(missing, rule)
+		}
+	}
+	return missing
+}
+
+/**
+ * Compares two lists.
+ *
+ * The coverage is checked for every hostname named by a rule on either
+ * side, hostnames that no rule names are not counted.
+ */
+func Diff(oldLines []string, newLines []string) Result {
+	oldRules, oldSet := normalizeAll(oldLines)
+	newRules, newSet := normalizeAll(newLines)
+
+	var result Result = Result{
+		Added:     missingFrom(newRules, oldSet),
+		Removed:   missingFrom(oldRules, newSet),
+		Covered:   []string{},
+		Uncovered: []string{},
+	}
+
+	var oldBlocking, newBlocking []string = blocking(oldRules), blocking(newRules)
+	var oldIndex *compress.Index = compress.NewIndex(oldBlocking)
+	var newIndex *compress.Index = compress.NewIndex(newBlocking)
+	var checked map[string]struct{} = make(map[string]struct{})
+	for _, hostname := range append(compress.Hostnames(oldBlocking), compress.Hostnames(newBlocking)...) {
+		if _, exists := checked[hostname]; exists {
+			continue
+		}
+		checked[hostname] = struct{}{}
+
+		var before, after bool = oldIndex.Blocks(hostname), newIndex.Blocks(hostname)
+		if after && !before {
+			result.Covered = append(result.Covered, hostname)
+		} else if before && !after {
+			result.Uncovered = append(result.Uncovered, hostname)
+		}
+	}
+	sort.Strings(result.Covered)
+	sort.Strings(result.Uncovered)
+
+	return result
+}
@@ -0,0 +1,49 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		{"! comment", nil},
+		{"   ", nil},
+		{"0.0.0.0 a.org b.org", []string{"||a.org^", "||b.org^"}},
+		{"example.org", []string{"||example.org^"}},
+		{"  ||example.org^$important  ", []string{"||example.org^$important"}},
+		{"@@||example.org^", []string{"@@||example.org^"}},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.rule); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var oldLines []string = []string{"! old", "||ads.example.org^", "0.0.0.0 old.net same.org", "||*.wild.org^"}
+	var newLines []string = []string{"! new", "||example.org^", "same.org", "||wild.org^"}
+
+	var want Result = Result{
+		Added:     []string{"||example.org^", "||wild.org^"},
+		Removed:   []string{"||ads.example.org^", "||old.net^", "||*.wild.org^"},
+		Covered:   []string{"example.org", "wild.org"},
+		Uncovered: []string{"old.net"},
+	}
+	if got := Diff(oldLines, newLines); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+
+	if got := Diff(oldLines, oldLines); !got.Empty() || len(got.Covered) != 0 || len(got.Uncovered) != 0 {
+		t.Errorf("Diff() of the same list = %+v", got)
+	}
+	var allowed Result = Diff([]string{"||b.org^"}, []string{"||example.org^", "@@||a.example.org^", "@@||b.org^"})
+	if want := []string{"example.org"}; !reflect.DeepEqual(allowed.Covered, want) || !reflect.DeepEqual(allowed.Uncovered, []string{"b.org"}) {
+		t.Errorf("Diff() with allowlist rules = %+v, want only %q newly covered", allowed, want)
+	}
+}
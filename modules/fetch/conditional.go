@@ -0,0 +1,151 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+)
+
+// A file fetched for a source, with the request options of the source
+type Request struct {
+	Source  string
+	Options RequestOptions
+	// The sha256 of the content fetched, what Revalidate compares with
+	Digest [32]byte
+}
+
+type conditionalEntry struct {
+	content  []byte
+	digest   [32]byte
+	metadata Metadata
+}
+
+/**
+ * Conditional keeps the content and the validators of the files fetched
+ * by its rounds, so that a file is only downloaded again when it changed.
+ * The HTTP sources are fetched with conditional requests, the others are
+ * read again and compared with the content kept. Everything fetched is
+ * kept in memory as long as the Conditional is, up to the MaxBytes of
+ * the request options.
+ */
+type Conditional struct {
+	mu      sync.Mutex
+	entries map[string]*conditionalEntry
+}
+
+func NewConditional() *Conditional {
+	return &Conditional{entries: make(map[string]*conditionalEntry)}
+}
+
+/**
+ * Round is one build. Every file is revalidated once per round with next,
+ * the build reading it again gets the same content.
+ */
+type Round struct {
+	conditional *Conditional
+	next        Fetcher
+	mu          sync.Mutex
+	checked     map[string]*conditionalEntry
+	fetched     []Request
+}
+
+func (c *Conditional) Round(next Fetcher) *Round {
+	return &Round{conditional: c, next: next, checked: make(map[string]*conditionalEntry)}
+}
+
+// Fetches the file with the validators kept
+func (c *Conditional) revalidate(ctx context.Context, next Fetcher, key string, source string) (*conditionalEntry, error) {
+	c.mu.Lock()
+	previous, known := c.entries[key]
+	c.mu.Unlock()
+
+	var metadata Metadata
+	var outer, _ = ctx.Value(metadataHookKey{}).(func(source string, metadata Metadata))
+	var fetchCtx context.Context = WithMetadataHook(ctx, func(fetched string, fetchedMetadata Metadata) {
+		if fetched == source {
+			metadata = fetchedMetadata
+		}
+		if outer != nil {
+			outer(fetched, fetchedMetadata)
+		}
+	})
+	if known {
+		fetchCtx = WithValidators(fetchCtx, previous.metadata)
+	}
+
+	body, err := next.Fetch(fetchCtx, source)
+	if errors.Is(err, ErrNotModified) && known {
+		return previous, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := readContent(body, requestOptionsFrom(ctx).MaxBytes)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *conditionalEntry = &conditionalEntry{content: content, digest: sha256.Sum256(content), metadata: metadata}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry, nil
+}
+
+func (r *Round) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	var options RequestOptions = requestOptionsFrom(ctx)
+	var key string = sharedKey(source, options)
+
+	r.mu.Lock()
+	entry, checked := r.checked[key]
+	r.mu.Unlock()
+	if !checked {
+		var err error
+		if entry, err = r.conditional.revalidate(ctx, r.next, key, source); err != nil {
+			return nil, err
+		}
+
+		r.mu.Lock()
+		r.checked[key] = entry
+		r.fetched = append(r.fetched, Request{Source: source, Options: options, Digest: entry.digest})
+		r.mu.Unlock()
+	}
+	return io.NopCloser(bytes.NewReader(entry.content)), nil
+}
+
+/**
+ * Revalidates the files of a previous build, those of Fetched, and
+ * returns those whose content is not the one that build read. None
+ * changed when it is empty, the build would be the same. The files are
+ * compared with the digests of the requests and not with the content the
+ * Conditional kept, so that the builds sharing a file all see it changed.
+ */
+func (r *Round) Revalidate(ctx context.Context, requests []Request) ([]Request, error) {
+	var changed []Request
+	for _, request := range requests {
+		body, err := r.Fetch(WithRequestOptions(ctx, request.Options), request.Source)
+		if err != nil {
+			return nil, err
+		}
+		body.Close()
+
+		r.mu.Lock()
+		var entry *conditionalEntry = r.checked[sharedKey(request.Source, request.Options)]
+		r.mu.Unlock()
+		if entry.digest != request.Digest {
+			changed = append(changed, request)
+		}
+	}
+	return changed, nil
+}
+
+// The files fetched in the round, in order
+func (r *Round) Fetched() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Request{}, r.fetched...)
+}
@@ -0,0 +1,133 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	GZIP  = "gzip"
+	BZIP2 = "bzip2"
+	ZLIB  = "zlib"
+	ZSTD  = "zstd"
+	XZ    = "xz"
+)
+
+var MAGIC_BYTES map[string][]byte = map[string][]byte{
+	GZIP:  {0x1f, 0x8b},
+	BZIP2: []byte("BZh"),
+	ZSTD:  {0x28, 0xb5, 0x2f, 0xfd},
+	XZ:    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+}
+
+var EXTENSIONS map[string]string = map[string]string{
+	".gz":  GZIP,
+	".bz2": BZIP2,
+	".zst": ZSTD,
+	".xz":  XZ,
+}
+
+// The compression of a Content-Encoding header, "" for none
+func fromEncoding(encoding string) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return ""
+	case "gzip", "x-gzip":
+		return GZIP
+	case "deflate":
+		return ZLIB
+	default:
+		return strings.ToLower(strings.TrimSpace(encoding))
+	}
+}
+
+// "https://example.org/list.txt.gz?v=2" -> gzip
+func fromExtension(source string) string {
+	var name string = source
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		name = u.Path
+	}
+	return EXTENSIONS[strings.ToLower(path.Ext(name))]
+}
+
+func fromMagic(head []byte) string {
+	for compression, magic := range MAGIC_BYTES {
+		if bytes.HasPrefix(head, magic) {
+			return compression
+		}
+	}
+	return ""
+}
+
+type decompressed struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressed) Close() error {
+	var err error
+	for _, closer := range d.closers {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+/**
+ * Wraps the body of a source to decompress it as it is read.
+ *
+ * The Content-Encoding, when there is one, is trusted. Otherwise the
+ * compression is detected from the first bytes of the content, the
+ * extension is only used to name a format that cannot be read, a ".gz"
+ * file that is already plain text (a server sending it with
+ * Content-Encoding: gzip) is read as it is.
+ * gzip, bzip2 and deflate are supported, zstd and xz are errors.
+ */
+func Decompress(body io.ReadCloser, source string, encoding string) (io.ReadCloser, error) {
+	var compression string = fromEncoding(encoding)
+
+	var buffered *bufio.Reader = bufio.NewReader(body)
+	if compression == "" {
+		// The error is the one of the first Read, returned below
+		head, _ := buffered.Peek(6)
+		compression = fromMagic(head)
+		if compression == "" && len(head) > 0 {
+			if extension := fromExtension(source); extension == ZSTD || extension == XZ {
+				compression = extension
+			}
+		}
+	}
+
+	var err error
+	switch compression {
+	case "":
+		return &decompressed{Reader: buffered, closers: []io.Closer{body}}, nil
+	case GZIP:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(buffered); err == nil {
+			return &decompressed{Reader: gz, closers: []io.Closer{gz, body}}, nil
+		}
+	case ZLIB:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(buffered); err == nil {
+			return &decompressed{Reader: zr, closers: []io.Closer{zr, body}}, nil
+		}
+	case BZIP2:
+		return &decompressed{Reader: bzip2.NewReader(buffered), closers: []io.Closer{body}}, nil
+	default:
+		body.Close()
+		return nil, fmt.Errorf("%s is compressed with %s, which is not supported (gzip, bzip2 and deflate are)", Redact(source), compression)
+	}
+
+	body.Close()
+	return nil, fmt.Errorf("unable to decompress %s as %s: %w", Redact(source), compression, err)
+}
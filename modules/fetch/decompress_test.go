@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const BZIP2_LIST = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x01\xf4\xcf\x3e\x00\x00\x0a\x5b\x80\x00\x10\x00\x01\x10\x00\x00\x01\x32\xa6\xd0\x54\x20\x00\x31\x43\x4d\x30\x00\x50\xd0\x07\xa9\x9e\xa8\xcd\x85\xa7\x16\xe0\xca\xb3\xc0\x8e\x9f\x17\x72\x45\x38\x50\x90\x01\xf4\xcf\x3e"
+
+func gzipped(t *testing.T, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecompress(t *testing.T) {
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write([]byte("||deflate.example.org^\n"))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		source   string
+		encoding string
+		content  string
+		want     string
+		wantErr  string
+	}{
+		{"plain", "list.txt", "", "||example.org^\n", "||example.org^\n", ""},
+		{"empty", "list.txt", "", "", "", ""},
+		{"gzip magic", "list.txt", "", gzipped(t, "||gzip.example.org^\n"), "||gzip.example.org^\n", ""},
+		{"gzip extension", "list.txt.gz", "", gzipped(t, "||gzip.example.org^\n"), "||gzip.example.org^\n", ""},
+		{"gzip encoding", "https://example.org/list.txt", "gzip", gzipped(t, "||gzip.example.org^\n"), "||gzip.example.org^\n", ""},
+		{"plain .gz", "https://example.org/list.txt.gz", "", "||example.org^\n", "||example.org^\n", ""},
+		{"bzip2", "list.txt.bz2", "", BZIP2_LIST, "||bzip2.example.org^\n", ""},
+		{"deflate", "https://example.org/list.txt", "deflate", deflated.String(), "||deflate.example.org^\n", ""},
+		{"zstd magic", "list.txt", "", "\x28\xb5\x2f\xfd\x00\x00", "", "zstd, which is not supported"},
+		{"zstd extension", "list.txt.zst", "", "not readable", "", "zstd, which is not supported"},
+		{"br encoding", "https://example.org/list.txt", "br", "not readable", "", "br, which is not supported"},
+		{"broken gzip", "https://example.org/list.txt", "gzip", "||example.org^\n", "", "unable to decompress"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := Decompress(io.NopCloser(strings.NewReader(tt.content)), tt.source, tt.encoding)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decompress() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Decompress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchCompressed(t *testing.T) {
+	var dir string = t.TempDir()
+	var path string = filepath.Join(dir, "list.txt.gz")
+	if err := os.WriteFile(path, []byte(gzipped(t, "||file.example.org^\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := read(t, FileFetcher{}, path); err != nil || got != "||file.example.org^\n" {
+		t.Errorf("FileFetcher.Fetch() = %q, %v", got, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list.txt.gz":
+			// A compressed file, not a compressed response
+			w.Header().Set("Content-Type", "application/gzip")
+			fmt.Fprint(w, gzipped(t, "||archive.example.org^\n"))
+		case "/list.txt":
+			w.Header().Set("Content-Encoding", "gzip")
+			fmt.Fprint(w, gzipped(t, "||encoded.example.org^\n"))
+		}
+	}))
+	defer server.Close()
+
+	var fetcher *HTTPFetcher = NewHTTPFetcher()
+	if got, err := read(t, fetcher, server.URL+"/list.txt.gz"); err != nil || got != "||archive.example.org^\n" {
+		t.Errorf("HTTPFetcher.Fetch(list.txt.gz) = %q, %v", got, err)
+	}
+	if got, err := read(t, fetcher, server.URL+"/list.txt"); err != nil || got != "||encoded.example.org^\n" {
+		t.Errorf("HTTPFetcher.Fetch(list.txt) = %q, %v", got, err)
+	}
+}
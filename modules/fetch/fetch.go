@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+/**
+ * Fetcher reads the content of a source, a URL or a local path.
+ * The caller is responsible for closing the returned reader.
+ */
+type Fetcher interface {
+	Fetch(ctx context.Context, source string) (io.ReadCloser, error)
+}
+
+// FetcherFunc turns a function into a Fetcher
+type FetcherFunc func(ctx context.Context, source string) (io.ReadCloser, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	return f(ctx, source)
+}
+
+// Scheme of the sources without one, local paths
+const FILE_SCHEME = "file"
+
+/**
+ * Registry picks the fetcher registered for the URL scheme of a source,
+ * it is a Fetcher itself. Sources without a scheme are local paths.
+ */
+type Registry struct {
+	mu       sync.RWMutex
+	fetchers map[string]Fetcher
+}
+
+// A registry with the http, https and file fetchers
+func NewRegistry() *Registry {
+	var r *Registry = &Registry{fetchers: make(map[string]Fetcher)}
+	var web *HTTPFetcher = NewHTTPFetcher()
+	r.Register("http", web)
+	r.Register("https", web)
+	r.Register(FILE_SCHEME, FileFetcher{})
+	return r
+}
+
+// Default is the registry used when no other fetcher is given
+var Default *Registry = NewRegistry()
+
+// Registers the fetcher on the Default registry
+func Register(scheme string, fetcher Fetcher) {
+	Default.Register(scheme, fetcher)
+}
+
+// A registry with the same fetchers, registering on it leaves r as it is
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var clone *Registry = &Registry{fetchers: make(map[string]Fetcher, len(r.fetchers))}
+	for scheme, fetcher := range r.fetchers {
+		clone.fetchers[scheme] = fetcher
+	}
+	return clone
+}
+
+// Registers the fetcher for the scheme, replacing the one registered before
+func (r *Registry) Register(scheme string, fetcher Fetcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fetchers[scheme] = fetcher
+}
+
+func (r *Registry) Schemes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var schemes []string
+	for scheme := range r.fetchers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+/**
+ * "https://example.org/list.txt" -> "https"
+ * "lists/local.txt", "C:\lists\local.txt" -> "file"
+ */
+func Scheme(source string) string {
+	u, err := url.Parse(source)
+	// One letter is a Windows drive
+	if err != nil || len(u.Scheme) <= 1 {
+		return FILE_SCHEME
+	}
+	return u.Scheme
+}
+
+func (r *Registry) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	var scheme string = Scheme(source)
+
+	r.mu.RLock()
+	fetcher, exists := r.fetchers[scheme]
+	r.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("no fetcher for the %s scheme of %s", scheme, Redact(source))
+	}
+
+	return fetcher.Fetch(ctx, source)
+}
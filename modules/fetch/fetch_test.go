@@ -0,0 +1,233 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func read(t *testing.T, fetcher Fetcher, source string) (string, error) {
+	t.Helper()
+	body, err := fetcher.Fetch(context.Background(), source)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	return string(content), err
+}
+
+func TestScheme(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"https://example.org/list.txt", "https"},
+		{"http://example.org/list.txt", "http"},
+		{"file:///tmp/list.txt", "file"},
+		{"s3://bucket/list.txt", "s3"},
+		{"lists/local.txt", "file"},
+		{"/tmp/list.txt", "file"},
+		{`C:\lists\local.txt`, "file"},
+		{"C:/lists/local.txt", "file"},
+	}
+
+	for _, tt := range tests {
+		if got := Scheme(tt.source); got != tt.want {
+			t.Errorf("Scheme(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var registry *Registry = NewRegistry()
+	if want := []string{"file", "http", "https"}; !reflect.DeepEqual(registry.Schemes(), want) {
+		t.Errorf("Schemes() = %q, want %q", registry.Schemes(), want)
+	}
+
+	if _, err := read(t, registry, "s3://bucket/list.txt"); err == nil {
+		t.Errorf("Fetch() of an unregistered scheme error = nil")
+	}
+
+	var memory *Memory = NewMemory(map[string]string{"s3://bucket/list.txt": "||example.org^\n"})
+	registry.Register("s3", memory)
+	if got, err := read(t, registry, "s3://bucket/list.txt"); err != nil || got != "||example.org^\n" {
+		t.Errorf("Fetch() = %q, %v", got, err)
+	}
+	if want := []string{"s3://bucket/list.txt"}; !reflect.DeepEqual(memory.Fetched(), want) {
+		t.Errorf("Fetched() = %q, want %q", memory.Fetched(), want)
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	var dir string = t.TempDir()
+	var path string = filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(path, []byte("||example.org^\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{path, "file://" + filepath.ToSlash(path)} {
+		if got, err := read(t, FileFetcher{}, source); err != nil || got != "||example.org^\n" {
+			t.Errorf("Fetch(%q) = %q, %v", source, got, err)
+		}
+	}
+
+	if _, err := read(t, FileFetcher{}, filepath.Join(dir, "missing.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Fetch() of a missing file error = %v", err)
+	}
+	if _, err := read(t, FileFetcher{}, dir); err == nil {
+		t.Errorf("Fetch() of a directory error = nil")
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "||example.org^\n")
+	}))
+	defer server.Close()
+
+	if got, err := read(t, NewHTTPFetcher(), server.URL+"/list.txt"); err != nil || got != "||example.org^\n" {
+		t.Errorf("Fetch() = %q, %v", got, err)
+	}
+	if _, err := read(t, NewHTTPFetcher(), server.URL+"/missing.txt"); err == nil {
+		t.Errorf("Fetch() of a 404 error = nil")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewHTTPFetcher().Fetch(ctx, server.URL+"/list.txt"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Fetch() with a cancelled context error = %v", err)
+	}
+}
+
+func TestShared(t *testing.T) {
+	var memory *Memory = NewMemory(map[string]string{"mem://a.txt": "||a.org^\n"})
+	var shared *Shared = NewShared(memory)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if content, err := read(t, shared, "mem://a.txt"); err != nil || content != "||a.org^\n" {
+				t.Errorf("Fetch() = %q, %v", content, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var withToken context.Context = WithRequestOptions(context.Background(), RequestOptions{Credentials: &Credentials{Type: AUTH_BEARER, Secret: NewSecret("token")}})
+	if body, err := shared.Fetch(withToken, "mem://a.txt"); err != nil {
+		t.Fatal(err)
+	} else {
+		body.Close()
+	}
+	if _, err := read(t, shared, "mem://missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Fetch() of a missing source error = %v", err)
+	}
+	if _, err := read(t, shared, "mem://missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Fetch() of a missing source error = %v", err)
+	}
+
+	// Once without credentials, once with them, once for the missing source
+	if want := []string{"mem://a.txt", "mem://a.txt", "mem://missing.txt"}; !reflect.DeepEqual(memory.Fetched(), want) {
+		t.Errorf("fetched %q, want %q", memory.Fetched(), want)
+	}
+}
+
+// Endless content, as an upstream sending a file of any size
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+func TestSharedMaxBytes(t *testing.T) {
+	var shared *Shared = NewShared(FetcherFunc(func(ctx context.Context, source string) (io.ReadCloser, error) {
+		return io.NopCloser(endlessReader{}), nil
+	}))
+
+	var ctx context.Context = WithRequestOptions(context.Background(), RequestOptions{MaxBytes: 1024})
+	body, err := shared.Fetch(ctx, "mem://endless.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	// One byte more than the limit, the limits of the source see it exceeded
+	if content, err := io.ReadAll(body); err != nil || len(content) != 1025 {
+		t.Errorf("Fetch() read %d bytes, %v, want 1025", len(content), err)
+	}
+}
+
+func TestConditionalMaxBytes(t *testing.T) {
+	var round *Round = NewConditional().Round(FetcherFunc(func(ctx context.Context, source string) (io.ReadCloser, error) {
+		return io.NopCloser(io.LimitReader(endlessReader{}, 1<<20)), nil
+	}))
+
+	var ctx context.Context = WithRequestOptions(context.Background(), RequestOptions{MaxBytes: 1024})
+	body, err := round.Fetch(ctx, "mem://huge.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if content, err := io.ReadAll(body); err != nil || len(content) != 1025 {
+		t.Errorf("Fetch() read %d bytes, %v, want 1025", len(content), err)
+	}
+}
+
+func TestSharedCanceled(t *testing.T) {
+	var started chan struct{} = make(chan struct{})
+	var memory *Memory = NewMemory(map[string]string{"mem://a.txt": "||a.org^\n"})
+	var shared *Shared = NewShared(FetcherFunc(func(ctx context.Context, source string) (io.ReadCloser, error) {
+		select {
+		case started <- struct{}{}:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		default:
+		}
+		return memory.Fetch(ctx, source)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var canceled chan error = make(chan error)
+	go func() {
+		_, err := shared.Fetch(ctx, "mem://a.txt")
+		canceled <- err
+	}()
+	<-started
+
+	// Another list waits for the download that is then canceled
+	var waiting chan string = make(chan string)
+	go func() {
+		content, err := read(t, shared, "mem://a.txt")
+		if err != nil {
+			t.Errorf("Fetch() after the first caller was canceled error = %v", err)
+		}
+		waiting <- content
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("Fetch() of the canceled caller error = %v", err)
+	}
+	if content := <-waiting; content != "||a.org^\n" {
+		t.Errorf("Fetch() after the first caller was canceled = %q", content)
+	}
+}
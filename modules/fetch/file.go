@@ -0,0 +1,37 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FileFetcher reads local paths and file:// URLs, compressed files are decompressed
+type FileFetcher struct{}
+
+func (FileFetcher) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	var path string = source
+	if strings.HasPrefix(source, FILE_SCHEME+"://") {
+		u, err := url.Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file URL %s: %w", source, err)
+		}
+		path = u.Path
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", source, err)
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("invalid URL or file path: %s", source)
+	}
+	reportMetadata(ctx, source, Metadata{URL: path, LastModified: info.ModTime().UTC().Format(http.TimeFormat)})
+	return Decompress(file, source, "")
+}
@@ -0,0 +1,137 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+const DEFAULT_USER_AGENT = "dns-hostlist-compiler"
+
+// Redirects followed for a request, as many as the default client follows
+const MAX_REDIRECTS = 10
+
+type HTTPOptions struct {
+	// DEFAULT_USER_AGENT when empty
+	UserAgent string
+	// Proxy URL, the HTTP_PROXY and HTTPS_PROXY variables are used when empty
+	Proxy string
+	// PEM file with certificates trusted in addition to the system ones
+	CABundle string
+}
+
+type HTTPFetcher struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+func NewHTTPFetcher() *HTTPFetcher {
+	fetcher, _ := NewHTTPFetcherWithOptions(HTTPOptions{})
+	return fetcher
+}
+
+func NewHTTPFetcherWithOptions(options HTTPOptions) (*HTTPFetcher, error) {
+	var transport *http.Transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %s", Redact(options.Proxy))
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if options.CABundle != "" {
+		pem, err := os.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in the CA bundle %s", options.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	var userAgent string = options.UserAgent
+	if userAgent == "" {
+		userAgent = DEFAULT_USER_AGENT
+	}
+
+	return &HTTPFetcher{
+		Client: &http.Client{
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
+		},
+		UserAgent: userAgent,
+	}, nil
+}
+
+/**
+ * Responses other than 2xx are errors, an error page is not a list.
+ * The headers and credentials of the RequestOptions in the context are
+ * added to the request. Compressed responses are decompressed.
+ * With the validators of WithValidators the request is conditional.
+ */
+func (f *HTTPFetcher) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s", Redact(source))
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	requestOptionsFrom(ctx).apply(req)
+	var validators Metadata = validatorsFrom(ctx)
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching %s:\n%w", Redact(source), err)
+	}
+	if resp.StatusCode == http.StatusNotModified && (validators.ETag != "" || validators.LastModified != "") {
+		resp.Body.Close()
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error while fetching %s: %s", Redact(source), resp.Status)
+	}
+	reportMetadata(ctx, source, Metadata{
+		URL:          Redact(resp.Request.URL.String()),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	return Decompress(resp.Body, source, resp.Header.Get("Content-Encoding"))
+}
+
+/**
+ * Follows up to MAX_REDIRECTS redirects. The client only drops the
+ * Authorization and Cookie headers when redirected to another domain, the
+ * headers of the source, which may hold API keys, are dropped here when
+ * the host changes.
+ */
+func checkRedirect(r *http.Request, via []*http.Request) error {
+	if len(via) >= MAX_REDIRECTS {
+		return fmt.Errorf("stopped after %d redirects", MAX_REDIRECTS)
+	}
+	if r.URL.Host != via[0].URL.Host {
+		for name := range requestOptionsFrom(r.Context()).Headers {
+			r.Header.Del(name)
+		}
+	}
+	return nil
+}
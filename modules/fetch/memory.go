@@ -0,0 +1,56 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+/**
+ * Memory serves sources from a map, for tests and for lists built in
+ * memory. It records every source it was asked for.
+ */
+type Memory struct {
+	mu      sync.Mutex
+	sources map[string]string
+	fetched []string
+}
+
+func NewMemory(sources map[string]string) *Memory {
+	var m *Memory = &Memory{sources: make(map[string]string)}
+	for source, content := range sources {
+		m.sources[source] = content
+	}
+	return m
+}
+
+func (m *Memory) Set(source string, content string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources[source] = content
+}
+
+// The sources fetched so far, in order
+func (m *Memory) Fetched() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.fetched...)
+}
+
+func (m *Memory) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetched = append(m.fetched, source)
+	content, exists := m.sources[source]
+	if !exists {
+		return nil, fmt.Errorf("unable to open %s: %w", source, fs.ErrNotExist)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
@@ -0,0 +1,51 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+)
+
+// Metadata is what a fetcher learned about a source while fetching it
+type Metadata struct {
+	// URL the content came from after the redirects, without its password,
+	// the path for local files
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+type metadataHookKey struct{}
+
+/**
+ * The fetchers call the hook with the metadata of every source they
+ * fetch with the returned context, before returning the content.
+ */
+func WithMetadataHook(ctx context.Context, hook func(source string, metadata Metadata)) context.Context {
+	return context.WithValue(ctx, metadataHookKey{}, hook)
+}
+
+func reportMetadata(ctx context.Context, source string, metadata Metadata) {
+	if hook, ok := ctx.Value(metadataHookKey{}).(func(source string, metadata Metadata)); ok {
+		hook(source, metadata)
+	}
+}
+
+// Returned by a conditional fetch when the source did not change
+var ErrNotModified = errors.New("not modified")
+
+type validatorsKey struct{}
+
+/**
+ * Makes the fetches with the returned context conditional: the HTTP
+ * fetcher sends the ETag and Last-Modified of the metadata in
+ * If-None-Match and If-Modified-Since and returns ErrNotModified when
+ * the server answers 304. The other fetchers ignore them.
+ */
+func WithValidators(ctx context.Context, validators Metadata) context.Context {
+	return context.WithValue(ctx, validatorsKey{}, validators)
+}
+
+func validatorsFrom(ctx context.Context) Metadata {
+	validators, _ := ctx.Value(validatorsKey{}).(Metadata)
+	return validators
+}
@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	AUTH_BASIC  = "basic"
+	AUTH_BEARER = "bearer"
+)
+
+type Credentials struct {
+	// AUTH_BASIC or AUTH_BEARER
+	Type     string
+	Username string
+	// The password or the token
+	Secret Secret
+}
+
+/**
+ * RequestOptions are set for a source and used by the HTTP fetcher for
+ * the source and the files it includes.
+ */
+type RequestOptions struct {
+	Headers     map[string]string
+	Credentials *Credentials
+	// Largest content of a file Shared and Conditional keep in memory,
+	// the limits of the source then fail or truncate it. 0 is no limit.
+	MaxBytes int64
+}
+
+type requestOptionsKey struct{}
+
+func WithRequestOptions(ctx context.Context, options RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, options)
+}
+
+func requestOptionsFrom(ctx context.Context) RequestOptions {
+	options, _ := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return options
+}
+
+func (options RequestOptions) apply(req *http.Request) {
+	for name, value := range options.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if credentials := options.Credentials; credentials != nil {
+		switch credentials.Type {
+		case AUTH_BASIC:
+			req.SetBasicAuth(credentials.Username, credentials.Secret.Reveal())
+		case AUTH_BEARER:
+			req.Header.Set("Authorization", "Bearer "+credentials.Secret.Reveal())
+		}
+	}
+}
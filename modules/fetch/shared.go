@@ -0,0 +1,122 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type sharedContent struct {
+	done    chan struct{}
+	content []byte
+	err     error
+	// The download was canceled with the context of the caller
+	canceled bool
+}
+
+/**
+ * Shared fetches every source once for the builds running at the same
+ * time, the lists of a config sharing their sources. The first caller
+ * downloads the source and the others wait for its content, which is
+ * kept in memory as long as the Shared fetcher is. Only the download is
+ * shared, every caller reads the content from the start. A source fetched
+ * with other headers, credentials or MaxBytes is another source. When the
+ * caller downloading the source is canceled, the next one downloads it
+ * again.
+ */
+type Shared struct {
+	next    Fetcher
+	mu      sync.Mutex
+	sources map[string]*sharedContent
+}
+
+func NewShared(next Fetcher) *Shared {
+	return &Shared{next: next, sources: make(map[string]*sharedContent)}
+}
+
+// Key of a source with the request options it is fetched with
+func sharedKey(source string, options RequestOptions) string {
+	var names []string
+	for name := range options.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(source)
+	for _, name := range names {
+		key.WriteString("\x00" + name + ":" + options.Headers[name])
+	}
+	if credentials := options.Credentials; credentials != nil {
+		key.WriteString("\x00" + credentials.Type + ":" + credentials.Username + ":" + credentials.Secret.Reveal())
+	}
+	if options.MaxBytes > 0 {
+		key.WriteString(fmt.Sprintf("\x00%d", options.MaxBytes))
+	}
+	return key.String()
+}
+
+/**
+ * Reads a file into memory, at most maxBytes + 1 bytes of it so that the
+ * limits of the source still see it exceed maxBytes.
+ */
+func readContent(body io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
+	return io.ReadAll(body)
+}
+
+func (s *Shared) Fetch(ctx context.Context, source string) (io.ReadCloser, error) {
+	var options RequestOptions = requestOptionsFrom(ctx)
+	var key string = sharedKey(source, options)
+
+	for {
+		s.mu.Lock()
+		shared, found := s.sources[key]
+		if !found {
+			shared = &sharedContent{done: make(chan struct{})}
+			s.sources[key] = shared
+		}
+		s.mu.Unlock()
+
+		if !found {
+			s.download(ctx, key, source, options, shared)
+		}
+
+		select {
+		case <-shared.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if shared.canceled && ctx.Err() == nil {
+			continue
+		}
+		if shared.err != nil {
+			return nil, shared.err
+		}
+		return io.NopCloser(bytes.NewReader(shared.content)), nil
+	}
+}
+
+func (s *Shared) download(ctx context.Context, key string, source string, options RequestOptions, shared *sharedContent) {
+	body, err := s.next.Fetch(ctx, source)
+	if err == nil {
+		shared.content, err = readContent(body, options.MaxBytes)
+		body.Close()
+	}
+	shared.err = err
+
+	// The error is that of this caller, not of the source
+	if err != nil && ctx.Err() != nil {
+		shared.canceled = true
+		s.mu.Lock()
+		delete(s.sources, key)
+		s.mu.Unlock()
+	}
+	close(shared.done)
+}
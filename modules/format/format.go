@@ -0,0 +1,160 @@
+package format
+
+import (
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"fmt"
+	"strings"
+)
+
+const (
+	ADBLOCK = "adblock"
+	HOSTS   = "hosts"
+	DNSMASQ = "dnsmasq"
+)
+
+var FORMATS []string = []string{ADBLOCK, HOSTS, DNSMASQ}
+
+// Address the hostnames are blocked with in hosts files
+const HOSTS_ADDRESS = "0.0.0.0"
+
+func Validate(format string) error {
+	for _, f := range FORMATS {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, expected one of: %s", format, strings.Join(FORMATS, ", "))
+}
+
+/**
+ * Returns the character comments start with in the given format.
+ */
+func CommentPrefix(format string) string {
+	if format == HOSTS || format == DNSMASQ {
+		return "#"
+	}
+	return "!"
+}
+
+/**
+ * Converts a rule of any supported syntax to adblock-style rules:
+ * "0.0.0.0 example.org" and "example.org" become "||example.org^",
+ * comments start with "!" and adblock-style rules are left as they are.
+ */
+func ToAdblock(ruleText string) []string {
+	if ruleUtils.IsComment(ruleText) {
+		if strings.HasPrefix(ruleText, "#") {
+			return []string{"!" + strings.TrimLeft(ruleText, "#")}
+		}
+		return []string{ruleText}
+	}
+
+	if ruleUtils.IsEtcHostsRule(ruleText) {
+		props, err := ruleUtils.LoadEtcHostsRuleProperties(ruleText)
+		if err != nil {
+			return nil
+		}
+
+		var rules []string
+		for _, hostname := range props.Hostnames {
+			rules = append(rules, fmt.Sprintf("||%s^", hostname))
+		}
+		return rules
+	}
+
+	if ruleUtils.IsJustDomain(ruleText) {
+		return []string{fmt.Sprintf("||%s^", ruleText)}
+	}
+
+	return []string{ruleText}
+}
+
+/**
+ * Converts an adblock-style rule to a hosts file line.
+ *
+ * A hosts line only blocks the hostname itself, not its subdomains, so
+ * the list must keep the rules on the subdomains it blocks. Allowlist
+ * rules, regex rules and rules with modifiers other than $important
+ * cannot be expressed in a hosts file.
+ */
+func ToHosts(ruleText string) (string, bool) {
+	if ruleUtils.IsComment(ruleText) {
+		return toHashComment(ruleText), true
+	}
+
+	hostname, ok := blockedHostname(ruleText)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s", HOSTS_ADDRESS, hostname), true
+}
+
+/**
+ * Converts an adblock-style rule to a dnsmasq address line, which blocks
+ * the hostname and its subdomains with the null address:
+ * "||example.org^" -> "address=/example.org/#".
+ * The same rules as for hosts files cannot be written.
+ */
+func ToDnsmasq(ruleText string) (string, bool) {
+	if ruleUtils.IsComment(ruleText) {
+		return toHashComment(ruleText), true
+	}
+
+	hostname, ok := blockedHostname(ruleText)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("address=/%s/#", hostname), true
+}
+
+func toHashComment(ruleText string) string {
+	if strings.HasPrefix(ruleText, "!") {
+		return "#" + strings.TrimLeft(ruleText, "!")
+	}
+	return ruleText
+}
+
+// The hostname a rule blocks, false when it does more than block it
+func blockedHostname(ruleText string) (string, bool) {
+	props := ruleUtils.LoadAdblockRuleProperties(ruleText)
+	if props.Whitelist || props.Hostname == "" {
+		return "", false
+	}
+	for _, option := range props.Options {
+		if option.Name != "important" {
+			return "", false
+		}
+	}
+
+	return props.Hostname, true
+}
+
+/**
+ * Writes the rules in the given format and returns the number of rules
+ * that could not be expressed in it.
+ */
+func Render(rules []string, format string) ([]string, int) {
+	var rendered []string = make([]string, 0, len(rules))
+	var dropped int = 0
+
+	for _, rule := range rules {
+		for _, adblockRule := range ToAdblock(rule) {
+			switch format {
+			case HOSTS, DNSMASQ:
+				var convert func(string) (string, bool) = ToHosts
+				if format == DNSMASQ {
+					convert = ToDnsmasq
+				}
+				if line, ok := convert(adblockRule); ok {
+					rendered = append(rendered, line)
+				} else {
+					dropped += 1
+				}
+			default:
+				rendered = append(rendered, adblockRule)
+			}
+		}
+	}
+
+	return rendered, dropped
+}
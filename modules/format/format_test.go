@@ -0,0 +1,65 @@
+package format
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToAdblock(t *testing.T) {
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		{"0.0.0.0 example.org", []string{"||example.org^"}},
+		{"127.0.0.1 a.org b.org", []string{"||a.org^", "||b.org^"}},
+		{"example.org", []string{"||example.org^"}},
+		{"||example.org^$important", []string{"||example.org^$important"}},
+		{"# comment", []string{"! comment"}},
+		{"! comment", []string{"! comment"}},
+	}
+
+	for _, tt := range tests {
+		if got := ToAdblock(tt.rule); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ToAdblock(%q) = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestToHosts(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+		ok   bool
+	}{
+		{"||example.org^", "0.0.0.0 example.org", true},
+		{"||example.org^$important", "0.0.0.0 example.org", true},
+		{"! comment", "# comment", true},
+		{"@@||example.org^", "", false},
+		{"||example.org^$denyallow=a.org", "", false},
+		{"/ads[0-9]+/", "", false},
+		{"||*.example.org^", "", false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := ToHosts(tt.rule); got != tt.want || ok != tt.ok {
+			t.Errorf("ToHosts(%q) = %q, %v, want %q, %v", tt.rule, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var rules []string = []string{"||example.org^", "@@||example.net^", "0.0.0.0 a.org"}
+
+	if got, dropped := Render(rules, ADBLOCK); dropped != 0 || !reflect.DeepEqual(got, []string{"||example.org^", "@@||example.net^", "||a.org^"}) {
+		t.Errorf("Render(adblock) = %q, %d", got, dropped)
+	}
+	if got, dropped := Render(rules, HOSTS); dropped != 1 || !reflect.DeepEqual(got, []string{"0.0.0.0 example.org", "0.0.0.0 a.org"}) {
+		t.Errorf("Render(hosts) = %q, %d", got, dropped)
+	}
+	if got, dropped := Render(append(rules, "! comment"), DNSMASQ); dropped != 1 || !reflect.DeepEqual(got, []string{"address=/example.org/#", "address=/a.org/#", "# comment"}) {
+		t.Errorf("Render(dnsmasq) = %q, %d", got, dropped)
+	}
+	if CommentPrefix(DNSMASQ) != "#" {
+		t.Errorf("CommentPrefix(dnsmasq) = %q", CommentPrefix(DNSMASQ))
+	}
+}
@@ -0,0 +1,120 @@
+/**
+ * Package guard compares the number of rules of a build with the
+ * thresholds of the config and with the previous build, so a broken
+ * upstream returning an empty file is not published.
+ */
+package guard
+
+import (
+	"dns-hostlist-compiler/modules/config"
+	"dns-hostlist-compiler/modules/fetch"
+	"dns-hostlist-compiler/modules/header"
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Number of rules of a build, of the list and of every source by name
+type Counts struct {
+	Rules   int            `json:"rules"`
+	Sources map[string]int `json:"sources"`
+}
+
+/**
+ * Counts of a compiled list read back from its lines: the rules are the
+ * lines that are not comments, the sources are read from the header and
+ * are missing when the list was written without one.
+ */
+func CountsFromLines(lines []string) Counts {
+	var counts Counts = Counts{Sources: make(map[string]int)}
+	for _, line := range lines {
+		if !ruleUtils.IsComment(line) {
+			counts.Rules += 1
+		}
+	}
+	for _, source := range header.ParseSources(lines) {
+		counts.AddSource(source.Name, source.URL, source.Rules)
+	}
+	return counts
+}
+
+// Sources are known by name, by URL without its password when they have none
+func sourceName(name string, url string) string {
+	if name == "" {
+		return fetch.Redact(url)
+	}
+	return name
+}
+
+func (c *Counts) AddSource(name string, url string, rules int) {
+	if c.Sources == nil {
+		c.Sources = make(map[string]int)
+	}
+	c.Sources[sourceName(name, url)] = rules
+}
+
+type Breach struct {
+	// Name of the source, empty for the whole list
+	Source  string
+	Message string
+}
+
+func (b Breach) String() string {
+	if b.Source == "" {
+		return "the list " + b.Message
+	}
+	return b.Source + " " + b.Message
+}
+
+// Error is returned for a build breaching the guards
+type Error struct {
+	Breaches []Breach
+}
+
+func (e *Error) Error() string {
+	var messages []string
+	for _, breach := range e.Breaches {
+		messages = append(messages, breach.String())
+	}
+	return "guard breached: " + strings.Join(messages, "; ")
+}
+
+func check(guard config.Guard, source string, rules int, previous int, known bool) []Breach {
+	var breaches []Breach
+	if guard.MinRules > 0 && rules < guard.MinRules {
+		breaches = append(breaches, Breach{Source: source, Message: fmt.Sprintf("has %d rules, fewer than the minimum of %d", rules, guard.MinRules)})
+	}
+
+	// A source new to this build, or empty before, has nothing to compare with
+	if guard.MaxChangePercent > 0 && known && previous > 0 {
+		var change float64 = float64(rules-previous) * 100 / float64(previous)
+		if math.Abs(change) > guard.MaxChangePercent {
+			breaches = append(breaches, Breach{Source: source, Message: fmt.Sprintf("went from %d to %d rules (%+.1f%%), more than the maximum change of %g%%", previous, rules, change, guard.MaxChangePercent)})
+		}
+	}
+	return breaches
+}
+
+/**
+ * Checks the build against the guards of the list and of its sources,
+ * previous is nil for the first build.
+ */
+func Check(cfg config.Config, current Counts, previous *Counts) []Breach {
+	if previous == nil {
+		previous = &Counts{}
+	}
+
+	var breaches []Breach
+	for _, source := range cfg.Sources {
+		if source.Guard == nil {
+			continue
+		}
+		var name string = sourceName(source.Name, source.Source)
+		before, known := previous.Sources[name]
+		breaches = append(breaches, check(*source.Guard, name, current.Sources[name], before, known)...)
+	}
+
+	var known bool = previous.Rules > 0 || len(previous.Sources) > 0
+	return append(breaches, check(cfg.Guard.Guard, "", current.Rules, previous.Rules, known)...)
+}
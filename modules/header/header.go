@@ -0,0 +1,153 @@
+package header
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ADBLOCK_COMMENT = "!"
+	HOSTS_COMMENT   = "#"
+)
+
+var checksumRegex *regexp.Regexp = regexp.MustCompile(`(?i)^\s*[!#]\s*checksum[\s\-:]+[\w+/=]+`)
+
+type SourceSummary struct {
+	Name  string
+	URL   string
+	Rules int
+}
+
+type Metadata struct {
+	Title       string
+	Description string
+	Homepage    string
+	License     string
+	Version     string
+	TimeUpdated time.Time
+	Expires     string
+	Sources     []SourceSummary
+}
+
+/**
+ * Builds the header of the compiled list. Every line is a comment starting
+ * with the given prefix: "!" for adblock-style lists, "#" for hosts files.
+ * Empty fields are left out.
+ */
+func Build(meta Metadata, comment string) []string {
+	var lines []string = []string{comment}
+	field := func(name string, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%s %s: %s", comment, name, value))
+		}
+	}
+
+	field("Title", meta.Title)
+	field("Description", meta.Description)
+	field("Homepage", meta.Homepage)
+	field("License", meta.License)
+	field("Version", meta.Version)
+	if !meta.TimeUpdated.IsZero() {
+		field("TimeUpdated", meta.TimeUpdated.UTC().Format(time.RFC3339))
+	}
+	field("Expires", meta.Expires)
+	lines = append(lines, comment)
+
+	for _, source := range meta.Sources {
+		field("Source name", source.Name)
+		field("Source", source.URL)
+		field("Rules count", fmt.Sprint(source.Rules))
+		lines = append(lines, comment)
+	}
+
+	return lines
+}
+
+/**
+ * Computes the checksum of the list the way Adblock Plus and AdGuard do:
+ * the MD5 of the content without "\r", empty lines and the checksum line,
+ * base64-encoded without the trailing "=".
+ */
+func Checksum(lines []string) string {
+	hash := md5.New()
+	for _, line := range lines {
+		line = strings.ReplaceAll(line, "\r", "")
+		if line == "" || checksumRegex.MatchString(line) {
+			continue
+		}
+		hash.Write([]byte(line))
+		hash.Write([]byte("\n"))
+	}
+
+	return strings.TrimRight(base64.StdEncoding.EncodeToString(hash.Sum(nil)), "=")
+}
+
+/**
+ * Inserts a checksum line after the first line of the list,
+ * replacing an existing one.
+ */
+func AddChecksum(lines []string, comment string) []string {
+	var withChecksum []string = make([]string, 0, len(lines)+1)
+	for _, line := range lines {
+		if !checksumRegex.MatchString(line) {
+			withChecksum = append(withChecksum, line)
+		}
+	}
+
+	var checksum string = fmt.Sprintf("%s Checksum: %s", comment, Checksum(withChecksum))
+	if len(withChecksum) == 0 {
+		return []string{checksum}
+	}
+	return slices.Insert(withChecksum, 1, checksum)
+}
+
+/**
+ * Reads the sources back from the header of a compiled list,
+ * the sources without a rules count are left out.
+ */
+func ParseSources(lines []string) []SourceSummary {
+	var sources []SourceSummary
+	// Index of the source the fields are read for, -1 before the first
+	var current int = -1
+	for _, line := range lines {
+		var trimmed string = strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, ADBLOCK_COMMENT) && !strings.HasPrefix(trimmed, HOSTS_COMMENT) {
+			// The header is over
+			break
+		}
+
+		name, value, found := strings.Cut(strings.TrimSpace(trimmed[1:]), ": ")
+		if !found {
+			continue
+		}
+		switch name {
+		case "Source name":
+			sources = append(sources, SourceSummary{Name: value, Rules: -1})
+			current = len(sources) - 1
+		case "Source":
+			// Sources without a name start with their URL
+			if current == -1 || sources[current].URL != "" {
+				sources = append(sources, SourceSummary{Rules: -1})
+				current = len(sources) - 1
+			}
+			sources[current].URL = value
+		case "Rules count":
+			if current != -1 {
+				fmt.Sscan(value, &sources[current].Rules)
+			}
+		}
+	}
+
+	var counted []SourceSummary
+	for _, source := range sources {
+		if source.Rules >= 0 {
+			counted = append(counted, source)
+		}
+	}
+	return counted
+}
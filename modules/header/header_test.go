@@ -0,0 +1,78 @@
+package header
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	var meta Metadata = Metadata{
+		Title:       "Test list",
+		Homepage:    "https://example.org",
+		TimeUpdated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Expires:     "1 day",
+		Sources:     []SourceSummary{{Name: "First", URL: "https://example.org/first.txt", Rules: 42}},
+	}
+
+	var want []string = []string{
+		"#",
+		"# Title: Test list",
+		"# Homepage: https://example.org",
+		"# TimeUpdated: 2024-01-02T03:04:05Z",
+		"# Expires: 1 day",
+		"#",
+		"# Source name: First",
+		"# Source: https://example.org/first.txt",
+		"# Rules count: 42",
+		"#",
+	}
+	if got := Build(meta, HOSTS_COMMENT); !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	var sources []SourceSummary = []SourceSummary{
+		{Name: "First", URL: "https://example.org/first.txt", Rules: 42},
+		{URL: "local.txt", Rules: 0},
+		{Name: "Third", URL: "https://example.org/third.txt", Rules: 7},
+	}
+	var lines []string = AddChecksum(append(Build(Metadata{Title: "Test list", Sources: sources}, ADBLOCK_COMMENT), "||example.org^", "! Rules count: 1"), ADBLOCK_COMMENT)
+
+	if got := ParseSources(lines); !reflect.DeepEqual(got, sources) {
+		t.Errorf("ParseSources() = %+v, want %+v", got, sources)
+	}
+	if got := ParseSources([]string{"||example.org^"}); got != nil {
+		t.Errorf("ParseSources() without a header = %+v", got)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	var lines []string = []string{"[Adblock Plus 2.0]", "! Title: Test", "||example.org^"}
+
+	// Empty lines, "\r" and an old checksum line do not change the checksum
+	var noisy []string = []string{"[Adblock Plus 2.0]\r", "! Checksum: abc", "", "! Title: Test", "", "||example.org^\r"}
+	if Checksum(lines) != Checksum(noisy) {
+		t.Errorf("Checksum() = %q and %q", Checksum(lines), Checksum(noisy))
+	}
+
+	if Checksum(lines) == Checksum([]string{"[Adblock Plus 2.0]", "! Title: Test", "||example.com^"}) {
+		t.Errorf("Checksum() did not change with the content")
+	}
+	if strings.HasSuffix(Checksum(lines), "=") {
+		t.Errorf("Checksum() = %q, padding was not removed", Checksum(lines))
+	}
+}
+
+func TestAddChecksum(t *testing.T) {
+	var lines []string = AddChecksum([]string{"!", "! Checksum: old", "! Title: Test", "||example.org^"}, ADBLOCK_COMMENT)
+
+	if len(lines) != 4 || lines[0] != "!" || !strings.HasPrefix(lines[1], "! Checksum: ") || lines[1] == "! Checksum: old" {
+		t.Fatalf("AddChecksum() = %q", lines)
+	}
+	if want := "! Checksum: " + Checksum(lines); lines[1] != want {
+		t.Errorf("AddChecksum() checksum line = %q, want %q", lines[1], want)
+	}
+}
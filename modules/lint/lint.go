@@ -0,0 +1,169 @@
+package lint
+
+import (
+	"dns-hostlist-compiler/modules/compress"
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"dns-hostlist-compiler/modules/validate"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rule IDs of the checks that need the whole list, the others come from validate.Check
+const (
+	REDUNDANT = "redundant"
+	DUPLICATE = "duplicate"
+)
+
+const (
+	ERROR   = "error"
+	WARNING = "warning"
+)
+
+// Short description of every rule ID, used by the SARIF report
+var RULES map[string]string = map[string]string{
+	validate.UNSUPPORTED_MODIFIER: "The rule uses a modifier that DNS blocklists do not support.",
+	validate.PATTERN_TOO_SHORT:    "The pattern is too short and would block too much.",
+	validate.INVALID_PATTERN:      "The pattern cannot match a domain name.",
+	validate.INVALID_HOSTNAME:     "The hostname is not valid.",
+	validate.SUSPICIOUS_RULE:      "The hostname or the end of a ||domain^ rule looks wrong, the compiler keeps the rule.",
+	validate.PUBLIC_SUFFIX:        "The rule blocks a whole public suffix, the compiler keeps the rule.",
+	REDUNDANT:                     "A parent domain is already blocked by another rule.",
+	DUPLICATE:                     "The same rule appears earlier in the list.",
+}
+
+type File struct {
+	Name  string
+	Lines []string
+}
+
+/**
+ * Diagnostic is a problem found on a line.
+ * Line and Column are 1-based, Column counts bytes.
+ */
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Text     string `json:"text"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+type position struct {
+	file int
+	line int
+}
+
+/**
+ * Lints the files as one list.
+ *
+ * Every line is checked with validate.Check, the rules it would drop are
+ * errors. The rules validate.Suspicious reports are warnings, as are
+ * duplicates and rules covered by a parent domain, which are looked for
+ * across all files.
+ */
+func Lint(files []File) []Diagnostic {
+	var diagnostics []Diagnostic
+	var rules []string
+	var positions []position
+
+	for f, file := range files {
+		for i, line := range file.Lines {
+			if problem := validate.Check(line); problem != nil {
+				diagnostics = append(diagnostics, Diagnostic{
+					File:     file.Name,
+					Line:     i + 1,
+					Column:   problem.Offset + 1,
+					Rule:     problem.Rule,
+					Severity: ERROR,
+					Message:  problem.Message,
+					Text:     line,
+				})
+				continue
+			}
+			if problem := validate.Suspicious(line); problem != nil {
+				diagnostics = append(diagnostics, Diagnostic{
+					File:     file.Name,
+					Line:     i + 1,
+					Column:   problem.Offset + 1,
+					Rule:     problem.Rule,
+					Severity: WARNING,
+					Message:  problem.Message,
+					Text:     line,
+				})
+			}
+			rules = append(rules, line)
+			positions = append(positions, position{file: f, line: i + 1})
+		}
+	}
+
+	var location = func(index int) string {
+		return fmt.Sprintf("%s:%d", files[positions[index].file].Name, positions[index].line)
+	}
+	var diagnostic = func(index int, rule string, message string) Diagnostic {
+		var text string = rules[index]
+		return Diagnostic{
+			File:     files[positions[index].file].Name,
+			Line:     positions[index].line,
+			Column:   len(text) - len(strings.TrimLeft(text, " \t")) + 1,
+			Rule:     rule,
+			Severity: WARNING,
+			Message:  message,
+			Text:     text,
+		}
+	}
+
+	var seen map[string]int = make(map[string]int)
+	var duplicate map[int]bool = make(map[int]bool)
+	for i, ruleText := range rules {
+		var trimmed string = strings.TrimSpace(ruleText)
+		if trimmed == "" || ruleUtils.IsComment(trimmed) {
+			continue
+		}
+		if first, exists := seen[trimmed]; exists {
+			duplicate[i] = true
+			diagnostics = append(diagnostics, diagnostic(i, DUPLICATE, fmt.Sprintf("duplicate of %s", location(first))))
+			continue
+		}
+		seen[trimmed] = i
+	}
+
+	var reported map[int]bool = make(map[int]bool)
+	for _, redundancy := range compress.Redundant(rules) {
+		// /etc/hosts rules can be covered once per hostname, report the first one
+		if duplicate[redundancy.Rule] || reported[redundancy.Rule] {
+			continue
+		}
+		reported[redundancy.Rule] = true
+		diagnostics = append(diagnostics, diagnostic(redundancy.Rule, REDUNDANT,
+			fmt.Sprintf("%s is already blocked by %s", redundancy.Hostname, location(redundancy.CoveredBy))))
+	}
+
+	var fileIndex map[string]int = make(map[string]int)
+	for f, file := range files {
+		fileIndex[file.Name] = f
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].File != diagnostics[j].File {
+			return fileIndex[diagnostics[i].File] < fileIndex[diagnostics[j].File]
+		}
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics
+}
+
+func Errors(diagnostics []Diagnostic) int {
+	var errors int = 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == ERROR {
+			errors += 1
+		}
+	}
+	return errors
+}
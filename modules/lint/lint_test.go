@@ -0,0 +1,67 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	var files []File = []File{
+		{Name: "a.txt", Lines: []string{"! list", "||example.org^", "||example.org^$script", "  ||ads.example.org^"}},
+		{Name: "b.txt", Lines: []string{"||example.org^", "||a^", "||example.net^foo", "0.0.0.0 co.uk"}},
+	}
+
+	var got []string
+	for _, diagnostic := range Lint(files) {
+		got = append(got, diagnostic.String())
+	}
+	var want []string = []string{
+		"a.txt:3:16: error: unsupported modifier $script [unsupported-modifier]",
+		"a.txt:4:3: warning: ads.example.org is already blocked by a.txt:2 [redundant]",
+		"b.txt:1:1: warning: duplicate of a.txt:2 [duplicate]",
+		`b.txt:2:1: error: pattern "||a^" is shorter than 5 characters [pattern-too-short]`,
+		`b.txt:3:14: warning: unexpected "foo" after the ^ separator [suspicious-rule]`,
+		`b.txt:4:9: warning: "co.uk" is a public suffix [public-suffix]`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lint() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var diagnostics []Diagnostic = Lint([]File{{Name: "a.txt", Lines: []string{"||a^", "||example.org^", "||example.org^"}}})
+	if Errors(diagnostics) != 1 || len(diagnostics) != 2 {
+		t.Fatalf("Lint() = %+v", diagnostics)
+	}
+
+	var text bytes.Buffer
+	if err := WriteReport(&text, TEXT, diagnostics); err != nil || !strings.HasSuffix(text.String(), "1 errors, 1 warnings\n") {
+		t.Errorf("text report = %q, %v", text.String(), err)
+	}
+
+	var decoded []Diagnostic
+	var out bytes.Buffer
+	if err := WriteReport(&out, JSON, diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[1].Rule != DUPLICATE {
+		t.Errorf("json report = %s, %v", out.String(), err)
+	}
+
+	var log sarifLog
+	out.Reset()
+	if err := WriteReport(&out, SARIF, diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil || log.Version != SARIF_VERSION || len(log.Runs[0].Results) != 2 ||
+		log.Runs[0].Results[0].Locations[0].PhysicalLocation.Region.StartLine != 1 {
+		t.Errorf("sarif report = %s, %v", out.String(), err)
+	}
+
+	if err := WriteReport(&out, "xml", diagnostics); err == nil {
+		t.Errorf("WriteReport(xml) error = nil")
+	}
+}
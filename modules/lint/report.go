@@ -0,0 +1,143 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	TEXT  = "text"
+	JSON  = "json"
+	SARIF = "sarif"
+)
+
+var REPORT_FORMATS []string = []string{TEXT, JSON, SARIF}
+
+const (
+	SARIF_SCHEMA  = "https://json.schemastore.org/sarif-2.1.0.json"
+	SARIF_VERSION = "2.1.0"
+)
+
+func WriteReport(w io.Writer, reportFormat string, diagnostics []Diagnostic) error {
+	switch reportFormat {
+	case TEXT:
+		return writeText(w, diagnostics)
+	case JSON:
+		return writeJSON(w, diagnostics)
+	case SARIF:
+		return writeSARIF(w, diagnostics)
+	default:
+		return fmt.Errorf("unknown report format %q", reportFormat)
+	}
+}
+
+func writeText(w io.Writer, diagnostics []Diagnostic) error {
+	for _, diagnostic := range diagnostics {
+		if _, err := fmt.Fprintln(w, diagnostic); err != nil {
+			return err
+		}
+	}
+
+	var errors int = Errors(diagnostics)
+	_, err := fmt.Fprintf(w, "%d errors, %d warnings\n", errors, len(diagnostics)-errors)
+	return err
+}
+
+func writeJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	var encoder *json.Encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+// The parts of SARIF 2.1.0 that code scanning tools read
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+func writeSARIF(w io.Writer, diagnostics []Diagnostic) error {
+	var ids []string
+	for id := range RULES {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var run sarifRun = sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "dns-hostlist-compiler"}},
+		Results: []sarifResult{},
+	}
+	for _, id := range ids {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: RULES[id]}})
+	}
+
+	for _, diagnostic := range diagnostics {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:  diagnostic.Rule,
+			Level:   diagnostic.Severity,
+			Message: sarifMessage{Text: diagnostic.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: diagnostic.File},
+				Region:           sarifRegion{StartLine: diagnostic.Line, StartColumn: diagnostic.Column},
+			}}},
+		})
+	}
+
+	var encoder *json.Encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: SARIF_SCHEMA, Version: SARIF_VERSION, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,181 @@
+/**
+ * Package lock records what every source resolved to when it was locked,
+ * so the list can be built again from the same content.
+ */
+package lock
+
+import (
+	"context"
+	"dns-hostlist-compiler/modules/fetch"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	VERSION          = 1
+	DEFAULT_LOCKFILE = "hostlist.lock.json"
+)
+
+/**
+ * Lockfile lists the files read for every source, the source itself
+ * first and then the files it includes, e.g.
+ *
+ *	{
+ *	  "version": 1,
+ *	  "created": "2024-05-01T12:00:00Z",
+ *	  "vendor": "vendor",
+ *	  "sources": [{
+ *	    "name": "Ads",
+ *	    "source": "https://example.org/ads.txt",
+ *	    "files": [{
+ *	      "location": "https://example.org/ads.txt",
+ *	      "url": "https://cdn.example.org/ads.txt",
+ *	      "fetched": "2024-05-01T12:00:00Z",
+ *	      "etag": "\"5e1f\"",
+ *	      "sha256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+ *	      "size": 4
+ *	    }]
+ *	  }]
+ *	}
+ */
+type Lockfile struct {
+	Version int `json:"version"`
+	// Build time of the locked builds
+	Created time.Time `json:"created"`
+	// Directory of the vendored content relative to the lockfile,
+	// empty when the content is in the cache
+	Vendor  string   `json:"vendor,omitempty"`
+	Sources []Source `json:"sources"`
+}
+
+type Source struct {
+	Name string `json:"name"`
+	// As in the config, without the password of the URL
+	Source string `json:"source"`
+	Files  []File `json:"files"`
+}
+
+type File struct {
+	// URL or path as the source or the !#include gave it, without its password
+	Location string `json:"location"`
+	// Where the content came from after the redirects
+	URL          string    `json:"url"`
+	Fetched      time.Time `json:"fetched"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	// Hex SHA-256 of the content after decompression
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+func Load(path string) (Lockfile, error) {
+	var lockfile Lockfile
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return lockfile, fmt.Errorf("unable to read the lockfile: %w", err)
+	}
+	if err := json.Unmarshal(content, &lockfile); err != nil {
+		return lockfile, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	if lockfile.Version != VERSION {
+		return lockfile, fmt.Errorf("lockfile %s has version %d, expected %d", path, lockfile.Version, VERSION)
+	}
+	return lockfile, nil
+}
+
+func (l Lockfile) Write(path string) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// Number of files in the lockfile, sources and includes
+func (l Lockfile) Files() int {
+	var count int = 0
+	for _, source := range l.Sources {
+		count += len(source.Files)
+	}
+	return count
+}
+
+/**
+ * Serves the locked files from the store, a location that is not in the
+ * lockfile is an error, nothing is fetched.
+ */
+func (l Lockfile) Fetcher(store Store) fetch.Fetcher {
+	var files map[string]File = make(map[string]File)
+	for _, source := range l.Sources {
+		for _, file := range source.Files {
+			files[file.Location] = file
+		}
+	}
+
+	return fetch.FetcherFunc(func(ctx context.Context, location string) (io.ReadCloser, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, exists := files[fetch.Redact(location)]
+		if !exists {
+			return nil, fmt.Errorf("%s is not in the lockfile, lock the sources again", fetch.Redact(location))
+		}
+		return store.Open(file.SHA256)
+	})
+}
+
+/**
+ * Recorder fetches the sources with another fetcher and keeps their
+ * content in a store, Take returns what was fetched since the last call.
+ */
+type Recorder struct {
+	next  fetch.Fetcher
+	store Store
+	clock func() time.Time
+
+	mu    sync.Mutex
+	files []File
+}
+
+func NewRecorder(next fetch.Fetcher, store Store, clock func() time.Time) *Recorder {
+	return &Recorder{next: next, store: store, clock: clock}
+}
+
+func (r *Recorder) Fetch(ctx context.Context, location string) (io.ReadCloser, error) {
+	var file File = File{Location: fetch.Redact(location), URL: fetch.Redact(location)}
+	ctx = fetch.WithMetadataHook(ctx, func(source string, metadata fetch.Metadata) {
+		file.URL = metadata.URL
+		file.ETag = metadata.ETag
+		file.LastModified = metadata.LastModified
+	})
+
+	file.Fetched = r.clock().UTC()
+	body, err := r.next.Fetch(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if file.SHA256, file.Size, err = r.store.Put(body); err != nil {
+		return nil, fmt.Errorf("unable to store %s: %w", file.Location, err)
+	}
+
+	r.mu.Lock()
+	r.files = append(r.files, file)
+	r.mu.Unlock()
+	return r.store.Open(file.SHA256)
+}
+
+func (r *Recorder) Take() []File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var files []File = r.files
+	r.files = nil
+	return files
+}
@@ -0,0 +1,81 @@
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * Store is a directory of contents named after their SHA-256,
+ * the vendor directory or the sources directory of the cache.
+ */
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) Store {
+	return Store{Dir: dir}
+}
+
+func (s Store) path(digest string) string {
+	return filepath.Join(s.Dir, digest)
+}
+
+// Copies the content into the store, returns its hex SHA-256 and size
+func (s Store) Put(content io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", 0, err
+	}
+
+	temp, err := os.CreateTemp(s.Dir, ".put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(temp.Name())
+
+	var digest hash.Hash = sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, digest), content)
+	if cerr := temp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	var sum string = hex.EncodeToString(digest.Sum(nil))
+	if err := os.Rename(temp.Name(), s.path(sum)); err != nil {
+		return "", 0, err
+	}
+	return sum, size, nil
+}
+
+type verifiedFile struct {
+	*os.File
+	expected string
+	digest   hash.Hash
+}
+
+// The content is checked against its name once it was read to the end
+func (f *verifiedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.digest.Write(p[:n])
+	if err == io.EOF {
+		if sum := hex.EncodeToString(f.digest.Sum(nil)); sum != f.expected {
+			return n, fmt.Errorf("%s was modified, its sha256 is %s", f.Name(), sum)
+		}
+	}
+	return n, err
+}
+
+func (s Store) Open(digest string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(digest))
+	if err != nil {
+		return nil, fmt.Errorf("the content %s is not in %s: %w", digest, s.Dir, err)
+	}
+	return &verifiedFile{File: file, expected: digest, digest: sha256.New()}, nil
+}
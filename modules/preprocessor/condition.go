@@ -0,0 +1,122 @@
+package preprocessor
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Evaluates an !#if condition such as "(adguard && !adguard_ext_safari)".
+ *
+ * The condition may contain platform constants, "true", "false", "!", "&&",
+ * "||" and parentheses. Constants that are not defined are false.
+ */
+func evaluate(condition string, constants map[string]bool) (bool, error) {
+	p := &conditionParser{input: condition, constants: constants}
+	result, err := p.parseOr()
+	if err != nil {
+		return false, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return false, fmt.Errorf("unexpected %q in condition %q", p.input[p.pos:], condition)
+	}
+	return result, nil
+}
+
+type conditionParser struct {
+	input     string
+	pos       int
+	constants map[string]bool
+}
+
+func (p *conditionParser) skipSpaces() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos += 1
+	}
+}
+
+func (p *conditionParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) parseOr() (bool, error) {
+	result, err := p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (p *conditionParser) parseAnd() (bool, error) {
+	result, err := p.parseNot()
+	if err != nil {
+		return false, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+func (p *conditionParser) parseNot() (bool, error) {
+	if p.consume("!") {
+		result, err := p.parseNot()
+		return !result, err
+	}
+	return p.parseOperand()
+}
+
+func (p *conditionParser) parseOperand() (bool, error) {
+	if p.consume("(") {
+		result, err := p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if !p.consume(")") {
+			return false, fmt.Errorf("missing \")\" in condition %q", p.input)
+		}
+		return result, nil
+	}
+
+	p.skipSpaces()
+	var start int = p.pos
+	for p.pos < len(p.input) && isConstantChar(p.input[p.pos]) {
+		p.pos += 1
+	}
+	if start == p.pos {
+		return false, fmt.Errorf("expected a constant at %d in condition %q", start, p.input)
+	}
+
+	var constant string = p.input[start:p.pos]
+	switch constant {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return p.constants[constant], nil
+}
+
+func isConstantChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
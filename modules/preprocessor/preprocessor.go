@@ -0,0 +1,232 @@
+package preprocessor
+
+import (
+	"bufio"
+	"context"
+	"dns-hostlist-compiler/modules/fetch"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// Platform constants used when none are configured
+	DEFAULT_PLATFORMS []string = []string{"adguard"}
+	// Longest line accepted from a source
+	MAX_LINE_LENGTH int = 1024 * 1024
+)
+
+/**
+ * Preprocessor resolves the directives of AdGuard filter lists before the
+ * comments are removed:
+ *
+ * !#include <path or URL> -- replaced with the content of the included file.
+ * Relative paths are resolved against the including source, the included
+ * file must come from the same origin and cycles are rejected.
+ * !#if (condition), !#else, !#endif -- the rules are kept only when the
+ * condition holds for the configured platform constants.
+ * !#safari_cb_affinity -- only used by Safari, the rules are kept.
+ */
+type Preprocessor struct {
+	constants map[string]bool
+	open      Opener
+}
+
+// Opener reads a source and its includes, fetch.Default when nil
+type Opener func(source string) (io.ReadCloser, error)
+
+func New(platforms []string, open Opener) *Preprocessor {
+	var constants map[string]bool = make(map[string]bool)
+	for _, platform := range platforms {
+		constants[strings.TrimSpace(platform)] = true
+	}
+
+	if open == nil {
+		open = func(source string) (io.ReadCloser, error) {
+			return fetch.Default.Fetch(context.Background(), source)
+		}
+	}
+	return &Preprocessor{constants: constants, open: open}
+}
+
+/**
+ * Reads the source line by line and passes every line that is not a
+ * directive, or hidden by one, to emit.
+ */
+func (p *Preprocessor) Process(source string, emit func(line string)) error {
+	return p.process(source, []string{source}, emit)
+}
+
+type conditionalBlock struct {
+	parentActive bool
+	condition    bool
+	inElse       bool
+}
+
+func (p *Preprocessor) process(source string, includeStack []string, emit func(line string)) error {
+	// Used in the errors, without the password of the URL
+	var name string = fetch.Redact(source)
+
+	body, err := p.open(source)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE_LENGTH)
+
+	var blocks []conditionalBlock
+	var active bool = true
+	var lineNumber int = 0
+
+	for scanner.Scan() {
+		var line string = scanner.Text()
+		lineNumber += 1
+
+		var trimmed string = strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "!#") {
+			if active {
+				emit(line)
+			}
+			continue
+		}
+
+		directive, argument := splitDirective(trimmed)
+		switch directive {
+		case "!#if":
+			condition, err := evaluate(argument, p.constants)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+			}
+			blocks = append(blocks, conditionalBlock{parentActive: active, condition: condition})
+			active = active && condition
+		case "!#else":
+			if len(blocks) == 0 || blocks[len(blocks)-1].inElse {
+				return fmt.Errorf("%s:%d: unexpected !#else", name, lineNumber)
+			}
+			var block *conditionalBlock = &blocks[len(blocks)-1]
+			block.inElse = true
+			active = block.parentActive && !block.condition
+		case "!#endif":
+			if len(blocks) == 0 {
+				return fmt.Errorf("%s:%d: unexpected !#endif", name, lineNumber)
+			}
+			active = blocks[len(blocks)-1].parentActive
+			blocks = blocks[:len(blocks)-1]
+		case "!#include":
+			if !active {
+				continue
+			}
+			included, err := resolveInclude(includeStack[0], source, argument)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+			}
+			for _, parent := range includeStack {
+				if parent == included {
+					return fmt.Errorf("%s:%d: include cycle: %s -> %s", name, lineNumber, redactAll(includeStack), fetch.Redact(included))
+				}
+			}
+			if err := p.process(included, append(includeStack, included), emit); err != nil {
+				return err
+			}
+		case "!#safari_cb_affinity":
+			// Drop the directive, keep the rules
+		default:
+			// Not a directive, just a comment
+			if active {
+				emit(line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error while reading %s: %w", name, err)
+	}
+
+	if len(blocks) > 0 {
+		return fmt.Errorf("%s: missing !#endif", name)
+	}
+
+	return nil
+}
+
+// The path of a file:// URL, other sources are returned as they are
+func localPath(source string) string {
+	if !strings.HasPrefix(source, fetch.FILE_SCHEME+"://") {
+		return source
+	}
+	if u, err := url.Parse(source); err == nil {
+		return filepath.FromSlash(u.Path)
+	}
+	return source
+}
+
+func redactAll(sources []string) string {
+	var redacted []string
+	for _, source := range sources {
+		redacted = append(redacted, fetch.Redact(source))
+	}
+	return strings.Join(redacted, " -> ")
+}
+
+// "!#if (adguard)" -> "!#if", "(adguard)"
+func splitDirective(line string) (string, string) {
+	var end int = strings.IndexAny(line, " \t(")
+	if end == -1 {
+		return line, ""
+	}
+	return line[:end], strings.TrimSpace(line[end:])
+}
+
+/**
+ * Resolves an !#include path against the including source.
+ *
+ * Remote sources may only include files from the same scheme and host,
+ * local sources may only include local files from the directory of the
+ * top-level source. A file:// source is resolved as a local path and its
+ * includes are file:// URLs too.
+ */
+func resolveInclude(root string, source string, include string) (string, error) {
+	if include == "" {
+		return "", fmt.Errorf("!#include without a path")
+	}
+
+	if strings.HasPrefix(source, fetch.FILE_SCHEME+"://") {
+		path, err := resolveInclude(localPath(root), localPath(source), localPath(include))
+		if err != nil {
+			return "", err
+		}
+		return (&url.URL{Scheme: fetch.FILE_SCHEME, Path: filepath.ToSlash(path)}).String(), nil
+	}
+
+	if base, err := url.Parse(source); err == nil && base.Scheme != "" && base.Host != "" {
+		ref, err := url.Parse(include)
+		if err != nil {
+			return "", fmt.Errorf("invalid !#include %s: %w", include, err)
+		}
+
+		var resolved *url.URL = base.ResolveReference(ref)
+		if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+			return "", fmt.Errorf("!#include %s is not from the same origin as %s", include, fetch.Redact(source))
+		}
+		return resolved.String(), nil
+	}
+
+	if ref, err := url.Parse(include); err == nil && ref.Scheme != "" && ref.Host != "" {
+		return "", fmt.Errorf("!#include %s is not from the same origin as %s", include, fetch.Redact(source))
+	}
+
+	var path string = include
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(source), path)
+	}
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(filepath.Dir(root), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("!#include %s is outside of the directory of %s", include, root)
+	}
+	return path, nil
+}
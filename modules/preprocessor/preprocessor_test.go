@@ -0,0 +1,164 @@
+package preprocessor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func process(t *testing.T, p *Preprocessor, source string) ([]string, error) {
+	t.Helper()
+
+	var lines []string
+	err := p.Process(source, func(line string) {
+		lines = append(lines, line)
+	})
+	return lines, err
+}
+
+func TestEvaluate(t *testing.T) {
+	var constants map[string]bool = map[string]bool{"adguard": true, "adguard_app_windows": true}
+
+	tests := []struct {
+		condition string
+		want      bool
+		wantErr   bool
+	}{
+		{"adguard", true, false},
+		{"(adguard)", true, false},
+		{"!adguard", false, false},
+		{"adguard_ext_safari", false, false},
+		{"adguard && !adguard_ext_safari", true, false},
+		{"(adguard_ext_safari || adguard_app_windows) && adguard", true, false},
+		{"!(adguard && adguard_app_windows)", false, false},
+		{"true && !false", true, false},
+		{"", false, true},
+		{"(adguard", false, true},
+		{"adguard &&", false, true},
+		{"adguard adguard", false, true},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluate(tt.condition, constants)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("evaluate(%q) = %v, %v, want %v, error %v", tt.condition, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms []string
+		want      []string
+	}{
+		{"adguard", []string{"adguard"}, []string{
+			"! Title: Main list",
+			"||main.example.org^",
+			"||included.example.org^",
+			"||adguard.example.org^",
+			"||affinity.example.org^",
+			"!#unknown directive stays a comment",
+		}},
+		{"safari", []string{"adguard", "adguard_ext_safari"}, []string{
+			"! Title: Main list",
+			"||main.example.org^",
+			"||included.example.org^",
+			"||other.example.org^",
+			"||safari.example.org^",
+			"||affinity.example.org^",
+			"!#unknown directive stays a comment",
+		}},
+		{"no platforms", nil, []string{
+			"! Title: Main list",
+			"||main.example.org^",
+			"||included.example.org^",
+			"||hidden.example.org^",
+			"||other.example.org^",
+			"||affinity.example.org^",
+			"!#unknown directive stays a comment",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := process(t, New(tt.platforms, nil), filepath.Join("testdata", "lists", "main.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Process() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"a.txt", "include cycle"},
+		{"escape.txt", "outside of the directory"},
+		{"remote.txt", "not from the same origin"},
+		{"unterminated.txt", "missing !#endif"},
+		{"missing.txt", "unable to open"},
+	}
+
+	for _, tt := range tests {
+		_, err := process(t, New(DEFAULT_PLATFORMS, nil), filepath.Join("testdata", "lists", tt.source))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Process(%s) error = %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
+
+func TestProcessFileURL(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("testdata", "lists", "main.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var source string = "file://" + filepath.ToSlash(path)
+
+	got, err := process(t, New(DEFAULT_PLATFORMS, nil), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got[:3], []string{"! Title: Main list", "||main.example.org^", "||included.example.org^"}) {
+		t.Errorf("Process(%s) = %q", source, got)
+	}
+
+	if _, err := process(t, New(DEFAULT_PLATFORMS, nil), strings.TrimSuffix(source, "main.txt")+"escape.txt"); err == nil || !strings.Contains(err.Error(), "outside of the directory") {
+		t.Errorf("Process() of a file:// include outside of the directory error = %v", err)
+	}
+}
+
+func TestProcessRemoteInclude(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/filters/main.txt":
+			fmt.Fprint(w, "||main.example.org^\n!#include part.txt\n")
+		case "/filters/part.txt":
+			fmt.Fprint(w, "||part.example.org^\n")
+		case "/filters/cross.txt":
+			fmt.Fprint(w, "!#include https://other.example.org/list.txt\n")
+		}
+	}))
+	defer server.Close()
+
+	got, err := process(t, New(DEFAULT_PLATFORMS, nil), server.URL+"/filters/main.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"||main.example.org^", "||part.example.org^"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Process() = %q, want %q", got, want)
+	}
+
+	if _, err := process(t, New(DEFAULT_PLATFORMS, nil), server.URL+"/filters/cross.txt"); err == nil || !strings.Contains(err.Error(), "same origin") {
+		t.Errorf("Process() error = %v, want a same origin error", err)
+	}
+}
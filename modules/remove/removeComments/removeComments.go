@@ -2,9 +2,38 @@ package removecomments
 
 import (
 	"dns-hostlist-compiler/modules/ruleUtils"
-	"fmt"
 )
 
+/**
+ * Stream removes comments from the rules as they are read.
+ * The slice returned by Process is reused on the next call.
+ */
+type Stream struct {
+	filtered []string
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Name() string {
+	return "removecomments"
+}
+
+func (s *Stream) Process(rules []string) []string {
+	s.filtered = s.filtered[:0]
+	for _, rule := range rules {
+		if !ruleUtils.IsComment(rule) {
+			s.filtered = append(s.filtered, rule)
+		}
+	}
+	return s.filtered
+}
+
+func (s *Stream) Flush() []string {
+	return nil
+}
+
 func RemoveComments(rules []string) []string {
 	var filtered []string
 	for _, rule := range rules {
@@ -13,6 +42,5 @@ func RemoveComments(rules []string) []string {
 		}
 	}
 
-	fmt.Printf("removecomments - start: %d\tend: %d\n", len(rules), len(filtered))
 	return filtered
 }
@@ -0,0 +1,63 @@
+package removecomments
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestRemoveComments(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"empty", nil, nil},
+		{"adblock comment", []string{"! comment", "||example.org^"}, []string{"||example.org^"}},
+		{"hosts comment", []string{"# comment", "0.0.0.0 example.org"}, []string{"0.0.0.0 example.org"}},
+		{"empty lines", []string{"", "  ", "example.org"}, []string{"example.org"}},
+		{"only comments", []string{"!", "#", "####"}, nil},
+		{"allowlist rule", []string{"@@||example.org^"}, []string{"@@||example.org^"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemoveComments(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RemoveComments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveCommentsGolden(t *testing.T) {
+	testutils.Golden(t, *update, RemoveComments)
+}
+
+func TestStreamMatchesRemoveComments(t *testing.T) {
+	var rules []string = testutils.GenerateCorpus(10_000)
+	var stream *Stream = NewStream()
+
+	var got []string
+	for i := 0; i < len(rules); i += 1000 {
+		got = append(got, stream.Process(rules[i:i+1000])...)
+	}
+	got = append(got, stream.Flush()...)
+
+	if want := RemoveComments(rules); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream returned %d rules, RemoveComments returned %d", len(got), len(want))
+	}
+}
+
+func BenchmarkRemoveComments(b *testing.B) {
+	var rules []string = testutils.GenerateCorpus(2_000_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		RemoveComments(rules)
+	}
+}
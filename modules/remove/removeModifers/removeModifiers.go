@@ -1,37 +1,66 @@
 package removemodifers
 
 import (
-	"fmt"
 	"strings"
 
 	"dns-hostlist-compiler/modules/ruleUtils"
 )
 
+func removeModifiers(rawRuleText string) string {
+	var ruleText string = strings.TrimSpace(rawRuleText)
+
+	if len(ruleText) == 0 || ruleUtils.IsComment(ruleText) {
+		return ruleText
+	}
+
+	props := ruleUtils.LoadAdblockRuleProperties(ruleText)
+	if props.Pattern == "" {
+		return ruleText
+	}
+
+	ruleUtils.RemoveModifier(&props, "third-party")
+	ruleUtils.RemoveModifier(&props, "3p")
+	ruleUtils.RemoveModifier(&props, "all")
+	ruleUtils.RemoveModifier(&props, "document")
+	ruleUtils.RemoveModifier(&props, "doc")
+	ruleUtils.RemoveModifier(&props, "popup")
+	return ruleUtils.AdblockRuleToString(props)
+}
+
+/**
+ * Stream removes the unsupported modifiers from the rules as they are read.
+ * The slice returned by Process is reused on the next call.
+ */
+type Stream struct {
+	filtered []string
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Name() string {
+	return "removemodifiers"
+}
+
+func (s *Stream) Process(rules []string) []string {
+	s.filtered = s.filtered[:0]
+	for _, rule := range rules {
+		s.filtered = append(s.filtered, removeModifiers(rule))
+	}
+	return s.filtered
+}
+
+func (s *Stream) Flush() []string {
+	return nil
+}
+
 func RemoveModifiers(rules []string) []string {
 	var filtered []string
 
 	for _, rawRuleText := range rules {
-		var ruleText string = strings.TrimSpace(rawRuleText)
-
-		if len(ruleText) == 0 || ruleUtils.IsComment(ruleText) {
-			filtered = append(filtered, ruleText)
-			continue
-		}
-
-		props := ruleUtils.LoadAdblockRuleProperties(ruleText)
-		if props.Pattern == "" {
-			filtered = append(filtered, ruleText)
-		}
-
-		ruleUtils.RemoveModifier(&props, "third-party")
-		ruleUtils.RemoveModifier(&props, "3p")
-		ruleUtils.RemoveModifier(&props, "all")
-		ruleUtils.RemoveModifier(&props, "document")
-		ruleUtils.RemoveModifier(&props, "doc")
-		ruleUtils.RemoveModifier(&props, "popup")
-		filtered = append(filtered, ruleUtils.AdblockRuleToString(props))
+		filtered = append(filtered, removeModifiers(rawRuleText))
 	}
 
-	fmt.Printf("removemodifiers - start: %d\tend: %d\n", len(rules), len(filtered))
 	return filtered
 }
@@ -0,0 +1,50 @@
+package removemodifers
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestRemoveModifiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"no modifiers", []string{"||example.org^"}, []string{"||example.org^"}},
+		{"third-party", []string{"||example.org^$third-party"}, []string{"||example.org^"}},
+		{"keeps supported", []string{"||example.org^$3p,important"}, []string{"||example.org^$important"}},
+		{"all removed", []string{"||example.org^$document,doc,all,popup"}, []string{"||example.org^"}},
+		{"allowlist", []string{"@@||example.org^$doc"}, []string{"@@||example.org^"}},
+		{"comment", []string{"! comment"}, []string{"! comment"}},
+		{"empty pattern", []string{"$third-party"}, []string{"$third-party"}},
+		{"trims", []string{"  ||example.org^  "}, []string{"||example.org^"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemoveModifiers(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RemoveModifiers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveModifiersGolden(t *testing.T) {
+	testutils.Golden(t, *update, RemoveModifiers)
+}
+
+func BenchmarkRemoveModifiers(b *testing.B) {
+	var rules []string = testutils.GenerateCorpus(2_000_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		RemoveModifiers(rules)
+	}
+}
@@ -0,0 +1,51 @@
+package ruleUtils
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The seeds are taken from real lists
+func addSeeds(f *testing.F) {
+	for _, line := range testutils.ReadLines(f, filepath.Join("testdata", "seeds.txt")) {
+		f.Add(line)
+	}
+}
+
+// parse -> AdblockRuleToString -> parse must give the same rule
+func FuzzLoadAdblockRuleProperties(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, ruleText string) {
+		props := LoadAdblockRuleProperties(ruleText)
+		var text string = AdblockRuleToString(props)
+		reparsed := LoadAdblockRuleProperties(text)
+
+		if reparsed.Pattern != props.Pattern || reparsed.Whitelist != props.Whitelist || !reflect.DeepEqual(reparsed.Options, props.Options) {
+			t.Errorf("%q -> %q\nparsed:   %+v\nreparsed: %+v", ruleText, text, props, reparsed)
+		}
+		if again := AdblockRuleToString(reparsed); again != text {
+			t.Errorf("%q -> %q -> %q", ruleText, text, again)
+		}
+	})
+}
+
+func FuzzLoadEtcHostsRuleProperties(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, ruleText string) {
+		props, err := LoadEtcHostsRuleProperties(ruleText)
+		if err != nil {
+			return
+		}
+		if len(props.Hostnames) == 0 {
+			t.Errorf("%q: no hostnames and no error", ruleText)
+		}
+		for _, hostname := range props.Hostnames {
+			if hostname == "" || strings.ContainsAny(hostname, "# \t\r\n") {
+				t.Errorf("%q: invalid hostname %q", ruleText, hostname)
+			}
+		}
+	})
+}
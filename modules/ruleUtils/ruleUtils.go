@@ -3,7 +3,6 @@ package ruleUtils
 import (
 	"dns-hostlist-compiler/modules/utils"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 )
@@ -37,6 +36,7 @@ var (
 	// Perl equivalent:
 	domainRegex   *regexp.Regexp = regexp.MustCompile(`^([0-9A-Za-z](?:[0-9A-Za-z-]{0,61}[0-9A-Za-z])?)(\.[0-9A-Za-z](?:[0-9A-Za-z-]{0,61}[0-9A-Za-z])?)*$`)
 	etcHostsRegex *regexp.Regexp = regexp.MustCompile(`^([a-f0-9.:\][]+)(%[a-z0-9]+)?\s+([^#]+)(#.*)?$`)
+	hostnameRegex *regexp.Regexp = regexp.MustCompile(`^\|\|([a-z0-9-.]+)\^$`)
 )
 
 func IsComment(ruleText string) bool {
@@ -68,15 +68,16 @@ func parseRuleTokens(ruleText string) AdblockRuleTokens {
 		startIndex = 2
 	}
 
+	// The rule is too short, leave the pattern empty
 	if len(ruleText) <= startIndex {
-		log.Fatalf("parseRuleTokens - the rule is too short: %s", ruleText)
+		return tokens
 	}
 
 	// Setting pattern to rule text (for the case of empty options)
 	tokens.Pattern = ruleText[startIndex:]
 
 	// Avoid parsing options inside of a regex rule
-	if strings.HasPrefix(tokens.Pattern, "/") && strings.HasSuffix(tokens.Options, "/") && !strings.Contains(tokens.Options, "replace=") {
+	if strings.HasPrefix(tokens.Pattern, "/") && strings.HasSuffix(tokens.Pattern, "/") && !strings.Contains(tokens.Pattern, "replace=") {
 		return tokens
 	}
 
@@ -103,16 +104,14 @@ func LoadEtcHostsRuleProperties(ruleText string) (EtcHostsRule, error) {
 	}
 
 	var hostnames []string = strings.Fields(rule)
-	hostnames = hostnames[1:]
-	if len(hostnames) < 1 {
+	if len(hostnames) < 2 {
 		return EtcHostsRule{}, fmt.Errorf("LoadEtcHostsRuleProperties - invalid /etc/hosts rule: %s", ruleText)
 	}
 
-	return EtcHostsRule{RuleText: ruleText, Hostnames: hostnames}, nil
+	return EtcHostsRule{RuleText: ruleText, Hostnames: hostnames[1:]}, nil
 }
 
 func extractHostname(pattern string) string {
-	var hostnameRegex *regexp.Regexp = regexp.MustCompile(`^\|\|([a-z0-9-.]+)\^$`)
 	var matches []string = hostnameRegex.FindStringSubmatch(pattern)
 	if len(matches) > 1 {
 		return matches[1]
@@ -136,6 +135,10 @@ func LoadAdblockRuleProperties(ruleText string) AdblockRule {
 			for _, option := range optionParts {
 				var parts []string = strings.SplitN(option, "=", 2)
 				var name string = parts[0]
+				if strings.TrimSpace(name) == "" {
+					// Not a modifier, e.g. "$=value"
+					continue
+				}
 				var value string
 				if len(parts) > 1 {
 					value = parts[1]
@@ -187,18 +190,34 @@ func AdblockRuleToString(ruleProps AdblockRule) string {
 	}
 	ruleText += ruleProps.Pattern
 
+	// A "$" or trailing whitespace in the pattern would be lost when the
+	// rule is parsed again, an empty options part keeps them in the pattern
+	if len(ruleProps.Options) == 0 && parseRuleTokens(strings.TrimSpace(ruleText)).Pattern != ruleProps.Pattern {
+		ruleText += "$"
+	}
+
 	if len(ruleProps.Options) > 0 {
 		ruleText += "$"
 		for i, option := range ruleProps.Options {
-			ruleText += option.Name
-			if len(option.Value) > 0 {
+			// Delimiters were unescaped when the options were parsed
+			ruleText += strings.ReplaceAll(option.Name, ",", "\\,")
+			// "=" keeps a trailing "\" from escaping the next delimiter
+			if len(option.Value) > 0 || strings.HasSuffix(option.Name, "\\") {
 				ruleText += "="
-				ruleText += option.Value
+				ruleText += strings.ReplaceAll(option.Value, ",", "\\,")
 			}
 			if i < len(ruleProps.Options)-1 {
 				ruleText += ","
 			}
 		}
+
+		// Trailing whitespace would be trimmed and "/...$.../" would be taken
+		// for a regex when the rule is parsed again, an empty last option
+		// keeps the options as they are
+		var trimmed string = strings.TrimSpace(ruleText)
+		if trimmed != ruleText || parseRuleTokens(trimmed).Pattern != ruleProps.Pattern {
+			ruleText += ","
+		}
 	}
 
 	return ruleText
@@ -0,0 +1,192 @@
+package ruleUtils
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestIsComment(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"", true},
+		{"   ", true},
+		{"! comment", true},
+		{"# comment", true},
+		{"####", true},
+		{"||example.org^", false},
+		{"0.0.0.0 example.org", false},
+		{"@@||example.org^", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsComment(tt.rule); got != tt.want {
+			t.Errorf("IsComment(%q) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestIsEtcHostsRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"0.0.0.0 example.org", true},
+		{"127.0.0.1 example.org www.example.org", true},
+		{"::1 example.org", true},
+		{"fe80::1%lo0 example.org", true},
+		{"0.0.0.0 example.org # comment", true},
+		{"||example.org^", false},
+		{"example.org", false},
+		{"0.0.0.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEtcHostsRule(tt.rule); got != tt.want {
+			t.Errorf("IsEtcHostsRule(%q) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestIsJustDomain(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"example.org", true},
+		{"sub.example-1.org", true},
+		{"localhost", false},
+		{"-example.org", false},
+		{"||example.org^", false},
+		{"example.org/path", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsJustDomain(tt.rule); got != tt.want {
+			t.Errorf("IsJustDomain(%q) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestLoadEtcHostsRuleProperties(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    []string
+		wantErr bool
+	}{
+		{"0.0.0.0 example.org", []string{"example.org"}, false},
+		{"0.0.0.0 a.org b.org\tc.org", []string{"a.org", "b.org", "c.org"}, false},
+		{"0.0.0.0 example.org # comment", []string{"example.org"}, false},
+		{"0.0.0.0 # comment", nil, true},
+		{"", nil, true},
+		{"# comment", nil, true},
+	}
+
+	for _, tt := range tests {
+		props, err := LoadEtcHostsRuleProperties(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LoadEtcHostsRuleProperties(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(props.Hostnames, tt.want) {
+			t.Errorf("LoadEtcHostsRuleProperties(%q) = %q, want %q", tt.rule, props.Hostnames, tt.want)
+		}
+	}
+}
+
+func TestLoadAdblockRuleProperties(t *testing.T) {
+	tests := []struct {
+		rule      string
+		pattern   string
+		options   []ruleOption
+		whitelist bool
+		hostname  string
+	}{
+		{"||example.org^", "||example.org^", []ruleOption{}, false, "example.org"},
+		{"@@||example.org^", "||example.org^", []ruleOption{}, true, "example.org"},
+		{"||example.org^$important", "||example.org^", []ruleOption{{"important", ""}}, false, "example.org"},
+		{"||example.org^$denyallow=a.org|b.org,3p", "||example.org^", []ruleOption{{"denyallow", "a.org|b.org"}, {"3p", ""}}, false, "example.org"},
+		{"||example.org^$domain=a\\,b", "||example.org^", []ruleOption{{"domain", "a,b"}}, false, "example.org"},
+		{"||example.org\\$^", "||example.org\\$^", []ruleOption{}, false, ""},
+		{"||sub.example.org^|", "||sub.example.org^|", []ruleOption{}, false, ""},
+		{"@@", "", []ruleOption{}, true, ""},
+		{"/ads$/", "/ads$/", []ruleOption{}, false, ""},
+		{"/ads/$important", "/ads/", []ruleOption{{"important", ""}}, false, ""},
+		{"||example.org^$=value,important", "||example.org^", []ruleOption{{"important", ""}}, false, "example.org"},
+	}
+
+	for _, tt := range tests {
+		props := LoadAdblockRuleProperties(tt.rule)
+		if props.Pattern != tt.pattern || props.Whitelist != tt.whitelist || props.Hostname != tt.hostname || !reflect.DeepEqual(props.Options, tt.options) {
+			t.Errorf("LoadAdblockRuleProperties(%q) = %+v", tt.rule, props)
+		}
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	props := LoadAdblockRuleProperties("||example.org^$third-party,important,third-party")
+
+	if option := FindModifier(props, "important"); option == nil {
+		t.Errorf("FindModifier(important) = nil")
+	}
+	if option := FindModifier(props, "popup"); option != nil {
+		t.Errorf("FindModifier(popup) = %+v, want nil", option)
+	}
+	if !RemoveModifier(&props, "third-party") {
+		t.Errorf("RemoveModifier(third-party) = false")
+	}
+	if RemoveModifier(&props, "third-party") {
+		t.Errorf("RemoveModifier(third-party) removed the modifier twice")
+	}
+	if got := AdblockRuleToString(props); got != "||example.org^$important" {
+		t.Errorf("AdblockRuleToString() = %q", got)
+	}
+}
+
+func TestAdblockRuleToString(t *testing.T) {
+	for _, rule := range []string{
+		"||example.org^",
+		"@@||example.org^",
+		"||example.org^$important",
+		"@@||example.org^$denyallow=a.org|b.org,important",
+		"||example.org^$domain=a\\,b",
+		"/ads$/",
+		"$$",
+	} {
+		if got := AdblockRuleToString(LoadAdblockRuleProperties(rule)); got != rule {
+			t.Errorf("AdblockRuleToString(%q) = %q", rule, got)
+		}
+	}
+}
+
+func TestLoadAdblockRulePropertiesGolden(t *testing.T) {
+	testutils.Golden(t, *update, func(rules []string) []string {
+		var parsed []string
+		for _, rule := range rules {
+			props := LoadAdblockRuleProperties(rule)
+			parsed = append(parsed, fmt.Sprintf("%s\tpattern=%q options=%v whitelist=%v hostname=%q", rule, props.Pattern, props.Options, props.Whitelist, props.Hostname))
+		}
+		return parsed
+	})
+}
+
+func BenchmarkLoadAdblockRuleProperties(b *testing.B) {
+	var rules []string = testutils.GenerateCorpus(2_000_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		for _, rule := range rules {
+			if !IsComment(rule) {
+				LoadAdblockRuleProperties(rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/**
+ * Package schedule parses the schedules of the lists: a standard cron
+ * expression of five fields, one of the @hourly, @daily, @weekly,
+ * @monthly and @yearly shorthands, or an interval such as "@every 30m" or
+ * "6h".
+ */
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schedule interface {
+	// The first time after the given one, zero when there is none
+	Next(after time.Time) time.Time
+}
+
+// Every runs at a fixed interval from the previous run
+type Every struct {
+	Interval time.Duration
+}
+
+func (e Every) Next(after time.Time) time.Time {
+	return after.Add(e.Interval)
+}
+
+/**
+ * Cron matches the minutes of a cron expression, in the local time of the
+ * process. As in cron, when both the day of the month and the day of the
+ * week are restricted a day matching either of them matches.
+ */
+type Cron struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// The day of the month or of the week starts with "*"
+	anyDay     bool
+	anyWeekday bool
+}
+
+var SHORTHANDS map[string]string = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Shortest interval, a list is not worth rebuilding more often
+const MIN_INTERVAL = time.Minute
+
+var monthNames []string = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var weekdayNames []string = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var fields []field = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	// 7 is Sunday too
+	{"day of week", 0, 7, weekdayNames},
+}
+
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expression, found := SHORTHANDS[strings.ToLower(spec)]; found {
+		spec = expression
+	}
+
+	if strings.HasPrefix(spec, "@every ") || !strings.Contains(spec, " ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q, expected a cron expression or an interval such as @every 1h", spec)
+		}
+		if interval < MIN_INTERVAL {
+			return nil, fmt.Errorf("invalid schedule %q, the interval must be at least %s", spec, MIN_INTERVAL)
+		}
+		return Every{Interval: interval}, nil
+	}
+
+	var parts []string = strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q, a cron expression has %d fields", spec, len(fields))
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is 0 for time.Weekday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	var cron *Cron = &Cron{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     strings.HasPrefix(parts[2], "*"),
+		anyWeekday: strings.HasPrefix(parts[4], "*"),
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q, it never runs", spec)
+	}
+	return cron, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(value, name) {
+			return i + f.min, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, value, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Parses a list of values, ranges and steps such as "1,15" or "9-17/2"
+func parseField(part string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(part, ",") {
+		var rangePart string = item
+		var step int = 1
+		if before, after, found := strings.Cut(item, "/"); found {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in the %s", after, f.name)
+			}
+			rangePart = before
+			step = n
+		}
+
+		var low, high int = f.min, f.max
+		if rangePart != "*" {
+			var err error
+			before, after, isRange := strings.Cut(rangePart, "-")
+			if low, err = parseValue(before, f); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseValue(after, f); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "5/15" is every 15 from 5
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in the %s", rangePart, f.name)
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	var day bool = c.days&(1<<t.Day()) != 0
+	var weekday bool = c.weekdays&(1<<int(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+/**
+ * Returns the first matching minute after the given time, skipping the
+ * months, days and hours that do not match. It gives up after 5 years.
+ */
+func (c *Cron) Next(after time.Time) time.Time {
+	var t time.Time = after.Truncate(time.Minute).Add(time.Minute)
+	var limit time.Time = t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.months&(1<<int(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if c.hours&(1<<t.Hour()) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if c.minutes&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// A daylight saving time change can move a wall clock time backwards
+func forward(from time.Time, to time.Time) time.Time {
+	if !to.After(from) {
+		return from.Add(time.Minute)
+	}
+	return to
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	var from time.Time = time.Date(2024, 5, 1, 12, 34, 56, 0, time.Local) // a Wednesday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 30m", from.Add(30 * time.Minute)},
+		{"6h", from.Add(6 * time.Hour)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 12, 45, 0, 0, time.Local)},
+		{"0 * * * *", time.Date(2024, 5, 1, 13, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local)},
+		{"30 4 * * mon-fri", time.Date(2024, 5, 2, 4, 30, 0, 0, time.Local)},
+		{"0 0 * * 7", time.Date(2024, 5, 5, 0, 0, 0, 0, time.Local)},
+		{"0 0 1 jan,jul *", time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local)},
+		{"0 3 29 2 *", time.Date(2028, 2, 29, 3, 0, 0, 0, time.Local)},
+		// Either the 15th or a Sunday
+		{"0 0 15 * sun", time.Date(2024, 5, 5, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "expected a cron expression or an interval"},
+		{"@every 10s", "at least 1m0s"},
+		{"* * * *", "has 5 fields"},
+		{"60 * * * *", "invalid minute"},
+		{"0 0 * * mon-sun-x", "invalid day of week"},
+		{"0 0 10-5 * *", "invalid range"},
+		{"*/0 * * * *", "invalid step"},
+		{"0 0 31 2 *", "never runs"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/**
+ * Package server serves the compiled lists over HTTP from memory. The
+ * builds are published as they finish, a list is swapped in as a whole so
+ * a client never gets files from two builds, and a failed build leaves
+ * the previous files in place.
+ */
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HEALTH_PATH  = "/healthz"
+	CONTENT_TYPE = "text/plain; charset=utf-8"
+)
+
+// File is a file of a list, served at /<Name>
+type File struct {
+	Name  string
+	Lines []string
+}
+
+// Status of the builds of a list, reported by the health endpoint
+type Status struct {
+	List string `json:"list"`
+	// Whether the last build was published
+	OK          bool      `json:"ok"`
+	Error       string    `json:"error,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	// Time of the build being served, zero before the first one
+	LastSuccess time.Time `json:"lastSuccess"`
+	Rules       int       `json:"rules"`
+	Files       []string  `json:"files"`
+}
+
+// A file ready to be served, compressed and with its validators
+type served struct {
+	list     string
+	content  []byte
+	gzipped  []byte
+	etag     string
+	modified time.Time
+}
+
+type state struct {
+	files  map[string]*served
+	status map[string]Status
+}
+
+type Server struct {
+	// Serializes the publishers, the readers only load the state
+	mu    sync.Mutex
+	state atomic.Pointer[state]
+	clock func() time.Time
+}
+
+/**
+ * Returns a server for the given lists, they are reported as not built
+ * by the health endpoint until their first build is published.
+ */
+func New(lists []string, clock func() time.Time) *Server {
+	if clock == nil {
+		clock = time.Now
+	}
+	var s *Server = &Server{clock: clock}
+	var initial *state = &state{files: make(map[string]*served), status: make(map[string]Status)}
+	for _, list := range lists {
+		initial.status[list] = Status{List: list, Files: []string{}}
+	}
+	s.state.Store(initial)
+	return s
+}
+
+func newServed(list string, lines []string, modified time.Time) (*served, error) {
+	var content []byte = []byte(strings.Join(lines, "\n") + "\n")
+	var digest [32]byte = sha256.Sum256(content)
+
+	var gzipped bytes.Buffer
+	var writer *gzip.Writer = gzip.NewWriter(&gzipped)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return &served{
+		list:     list,
+		content:  content,
+		gzipped:  gzipped.Bytes(),
+		etag:     `"` + hex.EncodeToString(digest[:16]) + `"`,
+		modified: modified.UTC().Truncate(time.Second),
+	}, nil
+}
+
+// Copies the state for a publisher, the files of the list are dropped
+func (s *Server) update(list string) *state {
+	var current *state = s.state.Load()
+	var next *state = &state{files: make(map[string]*served), status: make(map[string]Status)}
+	for name, file := range current.files {
+		if file.list != list {
+			next.files[name] = file
+		}
+	}
+	for name, status := range current.status {
+		next.status[name] = status
+	}
+	return next
+}
+
+/**
+ * Swaps in the files of a new build of the list. A file with the same
+ * content as the one served keeps its Last-Modified time.
+ */
+func (s *Server) Publish(list string, files []File, rules int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var now time.Time = s.clock()
+	var current *state = s.state.Load()
+	var next *state = s.update(list)
+	var status Status = Status{List: list, OK: true, LastAttempt: now, LastSuccess: now, Rules: rules, Files: []string{}}
+	for _, file := range files {
+		if previous, found := current.files[file.Name]; found && previous.list != list {
+			return &ConflictError{Name: file.Name, List: list, Other: previous.list}
+		}
+
+		built, err := newServed(list, file.Lines, now)
+		if err != nil {
+			return err
+		}
+		if previous, found := current.files[file.Name]; found && previous.etag == built.etag {
+			built.modified = previous.modified
+		}
+		next.files[file.Name] = built
+		status.Files = append(status.Files, "/"+file.Name)
+	}
+	next.status[list] = status
+
+	s.state.Store(next)
+	return nil
+}
+
+// Records a failed build of the list, its previous files are still served
+func (s *Server) Fail(list string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current *state = s.state.Load()
+	var next *state = &state{files: current.files, status: make(map[string]Status)}
+	for name, status := range current.status {
+		next.status[name] = status
+	}
+
+	var status Status = next.status[list]
+	status.List = list
+	status.OK = false
+	status.Error = err.Error()
+	status.LastAttempt = s.clock()
+	if status.Files == nil {
+		status.Files = []string{}
+	}
+	next.status[list] = status
+
+	s.state.Store(next)
+}
+
+// ConflictError is returned when two lists publish a file with the same name
+type ConflictError struct {
+	Name  string
+	List  string
+	Other string
+}
+
+func (e *ConflictError) Error() string {
+	return "/" + e.Name + " of " + e.List + " is already served for " + e.Other
+}
+
+// The status of every list, by name
+func (s *Server) Statuses() []Status {
+	var statuses []Status
+	for _, status := range s.state.Load().status {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].List < statuses[j].List })
+	return statuses
+}
+
+/**
+ * Returns the handler serving the files and the health endpoint. The
+ * files are sent gzip-compressed to the clients accepting it, and
+ * If-None-Match and If-Modified-Since requests are answered with 304 by
+ * http.ServeContent.
+ */
+func (s *Server) Handler() http.Handler {
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.HandleFunc(HEALTH_PATH, s.health)
+	mux.HandleFunc("/", s.serveFile)
+	return mux
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, found := s.state.Load().files[strings.TrimPrefix(r.URL.Path, "/")]
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	var content []byte = file.content
+	var etag string = file.etag
+	w.Header().Set("Vary", "Accept-Encoding")
+	if acceptsGzip(r) {
+		content = file.gzipped
+		// The compressed file is another representation with its own ETag
+		etag = strings.TrimSuffix(file.etag, `"`) + `-gzip"`
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", file.modified, bytes.NewReader(content))
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Reports the status of every list. The server is healthy, 200, once
+ * every list has a build to serve, even when its last build failed.
+ */
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	var statuses []Status = s.Statuses()
+	var code int = http.StatusOK
+	var overall string = "ok"
+	for _, status := range statuses {
+		if status.LastSuccess.IsZero() {
+			code = http.StatusServiceUnavailable
+			overall = "unavailable"
+			break
+		}
+		if !status.OK {
+			overall = "degraded"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Status string   `json:"status"`
+		Lists  []Status `json:"lists"`
+	}{overall, statuses})
+}
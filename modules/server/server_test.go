@@ -0,0 +1,107 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, handler http.Handler, path string, headers map[string]string) *http.Response {
+	t.Helper()
+	var req *http.Request = httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Result()
+}
+
+func body(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestServer(t *testing.T) {
+	var now time.Time = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var s *Server = New([]string{"Ads", "Malware"}, func() time.Time { return now })
+	var handler http.Handler = s.Handler()
+
+	if resp := get(t, handler, HEALTH_PATH, nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health before the first build = %d", resp.StatusCode)
+	}
+
+	if err := s.Publish("Ads", []File{{Name: "ads.txt", Lines: []string{"||a.org^"}}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish("Malware", []File{{Name: "malware.txt", Lines: []string{"||m.org^"}}}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp *http.Response = get(t, handler, "/ads.txt", nil)
+	var etag string = resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || body(t, resp) != "||a.org^\n" || resp.Header.Get("Content-Type") != CONTENT_TYPE || etag == "" {
+		t.Errorf("GET /ads.txt = %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := get(t, handler, "/ads.txt", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match = %d", resp.StatusCode)
+	}
+	if resp := get(t, handler, "/ads.txt", map[string]string{"If-Modified-Since": now.Format(http.TimeFormat)}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with If-Modified-Since = %d", resp.StatusCode)
+	}
+
+	resp = get(t, handler, "/ads.txt", map[string]string{"Accept-Encoding": "br, gzip"})
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("ETag") == etag {
+		t.Fatalf("gzip response headers = %v", resp.Header)
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(reader); err != nil || string(content) != "||a.org^\n" {
+		t.Errorf("gzip body = %q, %v", content, err)
+	}
+
+	// Same content: Last-Modified is kept. A failed build keeps the files.
+	now = now.Add(time.Hour)
+	if err := s.Publish("Ads", []File{{Name: "ads.txt", Lines: []string{"||a.org^"}}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	s.Fail("Malware", errors.New("upstream is down"))
+	if resp := get(t, handler, "/ads.txt", nil); resp.Header.Get("Last-Modified") != "Wed, 01 May 2024 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", resp.Header.Get("Last-Modified"))
+	}
+	if resp := get(t, handler, "/malware.txt", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /malware.txt after a failed build = %d", resp.StatusCode)
+	}
+
+	resp = get(t, handler, HEALTH_PATH, nil)
+	var health struct {
+		Status string
+		Lists  []Status
+	}
+	if err := json.Unmarshal([]byte(body(t, resp)), &health); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || health.Status != "degraded" || len(health.Lists) != 2 || health.Lists[1].OK || health.Lists[1].Error != "upstream is down" {
+		t.Errorf("health = %d %+v", resp.StatusCode, health)
+	}
+
+	var conflict *ConflictError
+	if err := s.Publish("Malware", []File{{Name: "ads.txt", Lines: []string{"||m.org^"}}}, 1); !errors.As(err, &conflict) || !strings.Contains(err.Error(), "Ads") {
+		t.Errorf("Publish() of a file of another list error = %v", err)
+	}
+	if resp := get(t, handler, "/missing.txt", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /missing.txt = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+/**
+ * Writes one row per source followed by the overlap matrix,
+ * the sources are numbered in the matrix to keep it narrow.
+ */
+func WriteTable(w io.Writer, sources []SourceStats) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "#\tSOURCE\tLINES\tCOMMENTS\tINVALID\tRULES\tUNIQUE")
+	for i, source := range sources {
+		var name string = source.Name
+		if name == "" {
+			name = source.URL
+		}
+		fmt.Fprintf(table, "%d\t%s\t%d\t%d\t%d\t%d\t%d\n", i+1, name, source.Lines, source.Comments, source.Invalid, source.Rules, source.Unique)
+	}
+
+	if err := table.Flush(); err != nil || len(sources) < 2 {
+		return err
+	}
+
+	var columns []string
+	for i := range sources {
+		columns = append(columns, fmt.Sprint(i+1))
+	}
+	fmt.Fprintf(table, "\nOVERLAP\t%s\n", strings.Join(columns, "\t"))
+	for i, source := range sources {
+		var row []string
+		for j, shared := range source.Overlap {
+			if i == j {
+				row = append(row, "-")
+			} else {
+				row = append(row, fmt.Sprint(shared))
+			}
+		}
+		fmt.Fprintf(table, "%d\t%s\n", i+1, strings.Join(row, "\t"))
+	}
+
+	return table.Flush()
+}
+
+func WriteJSON(w io.Writer, sources []SourceStats) error {
+	if sources == nil {
+		sources = []SourceStats{}
+	}
+
+	var encoder *json.Encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string][]SourceStats{"sources": sources})
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"dns-hostlist-compiler/modules/diff"
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"dns-hostlist-compiler/modules/validate"
+	"strings"
+)
+
+/**
+ * SourceStats counts the lines of a source.
+ *
+ * Rules are compared after diff.Normalize, so "0.0.0.0 example.org" in one
+ * source and "||example.org^" in another are the same rule.
+ * Overlap[i] is the number of rules this source shares with the i-th source.
+ */
+type SourceStats struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Lines    int    `json:"lines"`
+	Comments int    `json:"comments"`
+	Invalid  int    `json:"invalid"`
+	Rules    int    `json:"rules"`
+	Unique   int    `json:"unique"`
+	Overlap  []int  `json:"overlap"`
+}
+
+/**
+ * Collector gathers the statistics of several sources.
+ * Every valid rule keeps the list of the sources it was seen in.
+ */
+type Collector struct {
+	sources []SourceStats
+	owners  map[string][]int
+}
+
+func New() *Collector {
+	return &Collector{owners: make(map[string][]int)}
+}
+
+/**
+ * Counts the lines of a source, read passes every line of the source to
+ * the given function.
+ */
+func (c *Collector) AddSource(name string, url string, read func(emit func(line string)) error) error {
+	var index int = len(c.sources)
+	var source SourceStats = SourceStats{Name: name, URL: url}
+
+	err := read(func(line string) {
+		source.Lines += 1
+
+		if ruleUtils.IsComment(line) || len(strings.TrimSpace(line)) == 0 {
+			source.Comments += 1
+			return
+		}
+		if validate.Check(line) != nil {
+			source.Invalid += 1
+			return
+		}
+
+		for _, rule := range diff.Normalize(line) {
+			var owners []int = c.owners[rule]
+			if len(owners) > 0 && owners[len(owners)-1] == index {
+				// Repeated in the same source
+				continue
+			}
+			c.owners[rule] = append(owners, index)
+			source.Rules += 1
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	c.sources = append(c.sources, source)
+	return nil
+}
+
+func (c *Collector) Result() []SourceStats {
+	var sources []SourceStats = make([]SourceStats, len(c.sources))
+	for i, source := range c.sources {
+		source.Unique = 0
+		source.Overlap = make([]int, len(c.sources))
+		sources[i] = source
+	}
+
+	for _, owners := range c.owners {
+		if len(owners) == 1 {
+			sources[owners[0]].Unique += 1
+			continue
+		}
+		for _, i := range owners {
+			for _, j := range owners {
+				if i != j {
+					sources[i].Overlap[j] += 1
+				}
+			}
+		}
+	}
+
+	for i := range sources {
+		sources[i].Overlap[i] = sources[i].Rules
+	}
+	return sources
+}
@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lines(source ...string) func(emit func(line string)) error {
+	return func(emit func(line string)) error {
+		for _, line := range source {
+			emit(line)
+		}
+		return nil
+	}
+}
+
+func TestCollector(t *testing.T) {
+	var collector *Collector = New()
+	collector.AddSource("first", "first.txt", lines("! comment", "", "||example.org^", "||example.org^", "||only-first.org^", "||a^"))
+	collector.AddSource("second", "second.txt", lines("0.0.0.0 example.org shared.org", "||only-second.org^$script"))
+	collector.AddSource("third", "third.txt", lines("shared.org"))
+
+	var want []SourceStats = []SourceStats{
+		{Name: "first", URL: "first.txt", Lines: 6, Comments: 2, Invalid: 1, Rules: 2, Unique: 1, Overlap: []int{2, 1, 0}},
+		{Name: "second", URL: "second.txt", Lines: 2, Comments: 0, Invalid: 1, Rules: 2, Unique: 0, Overlap: []int{1, 2, 1}},
+		{Name: "third", URL: "third.txt", Lines: 1, Comments: 0, Invalid: 0, Rules: 1, Unique: 0, Overlap: []int{0, 1, 1}},
+	}
+	if got := collector.Result(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Result() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var collector *Collector = New()
+	collector.AddSource("first", "first.txt", lines("||example.org^"))
+	collector.AddSource("", "second.txt", lines("||example.org^", "||other.org^"))
+
+	var out bytes.Buffer
+	if err := WriteTable(&out, collector.Result()); err != nil {
+		t.Fatal(err)
+	}
+	var want string = strings.Join([]string{
+		"#  SOURCE      LINES  COMMENTS  INVALID  RULES  UNIQUE",
+		"1  first       1      0         0        1      0",
+		"2  second.txt  2      0         0        2      1",
+		"",
+		"OVERLAP  1  2",
+		"1        -  1",
+		"2        1  -",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("WriteTable() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,115 @@
+package testutils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Reads a file from the testdata directory, one rule per line.
+ */
+func ReadLines(t testing.TB, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unable to read %s: %v", path, err)
+	}
+	return lines
+}
+
+/**
+ * Runs the transformation over every testdata/*.input file and compares
+ * the result with the matching .golden file, or regenerates the golden
+ * files when update is set. The packages using it register an -update
+ * flag in their tests and pass its value.
+ */
+func Golden(t *testing.T, update bool, transform func([]string) []string) {
+	t.Helper()
+
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata/*.input files")
+	}
+
+	for _, input := range inputs {
+		var golden string = strings.TrimSuffix(input, ".input") + ".golden"
+		t.Run(filepath.Base(golden), func(t *testing.T) {
+			var got string = strings.Join(transform(ReadLines(t, input)), "\n") + "\n"
+
+			if update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("output does not match %s (run with -update to regenerate)\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+/**
+ * Generates a deterministic list that looks like a real blocklist:
+ * /etc/hosts rules, plain domains, adblock-style rules with and without
+ * modifiers, allowlist rules, regex rules, comments, invalid rules and
+ * duplicates.
+ */
+func GenerateCorpus(n int) []string {
+	var rules []string = make([]string, 0, n)
+	for i := 0; len(rules) < n; i += 1 {
+		// Roughly one hostname in eight repeats an earlier one
+		var hostname string = fmt.Sprintf("host%d.example%d.org", i%(n/8+1), i%1000)
+
+		switch i % 16 {
+		case 0:
+			rules = append(rules, fmt.Sprintf("! %s", hostname))
+		case 1:
+			rules = append(rules, "")
+		case 2, 3, 4:
+			rules = append(rules, fmt.Sprintf("0.0.0.0 %s", hostname))
+		case 5, 6:
+			rules = append(rules, hostname)
+		case 7, 8, 9:
+			rules = append(rules, fmt.Sprintf("||%s^", hostname))
+		case 10:
+			rules = append(rules, fmt.Sprintf("||%s^$third-party", hostname))
+		case 11:
+			rules = append(rules, fmt.Sprintf("||%s^$important", hostname))
+		case 12:
+			rules = append(rules, fmt.Sprintf("@@||%s^", hostname))
+		case 13:
+			rules = append(rules, fmt.Sprintf("||example%d.org^", i%1000))
+		case 14:
+			rules = append(rules, fmt.Sprintf("/ads%d[0-9]+/", i%100))
+		case 15:
+			// Invalid: unsupported modifier and too short
+			rules = append(rules, fmt.Sprintf("||%s^$script", hostname))
+			rules = append(rules, "||a^")
+		}
+	}
+	return rules[:n]
+}
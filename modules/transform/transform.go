@@ -0,0 +1,81 @@
+/**
+ * Package transform holds the transformations an output can add to the
+ * ones every build runs, they work on the compiled adblock-style rules
+ * before they are written in the format of the output.
+ */
+package transform
+
+import (
+	"dns-hostlist-compiler/modules/ruleUtils"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Drops the @@ rules, for outputs whose blockers have no allowlist
+	REMOVE_ALLOW_RULES = "removeallowrules"
+	// Drops the /regex/ rules, which many blockers do not support
+	REMOVE_REGEX_RULES = "removeregexrules"
+	// Sorts the rules, so two builds are easy to compare
+	SORT = "sort"
+)
+
+var TRANSFORMATIONS []string = []string{REMOVE_ALLOW_RULES, REMOVE_REGEX_RULES, SORT}
+
+func Validate(names []string) error {
+	for _, name := range names {
+		if !isKnown(name) {
+			return fmt.Errorf("unknown transformation %q, expected one of: %s", name, strings.Join(TRANSFORMATIONS, ", "))
+		}
+	}
+	return nil
+}
+
+func isKnown(name string) bool {
+	for _, known := range TRANSFORMATIONS {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegexRule(ruleText string) bool {
+	var pattern string = strings.TrimPrefix(ruleText, "@@")
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.Contains(pattern[1:], "/")
+}
+
+func filter(rules []string, drop func(rule string) bool) []string {
+	var kept []string = make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if !drop(rule) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
+
+/**
+ * Runs the transformations in the given order, the rules passed in are
+ * left as they are.
+ */
+func Apply(rules []string, names []string) ([]string, error) {
+	if err := Validate(names); err != nil {
+		return nil, err
+	}
+
+	var transformed []string = rules
+	for _, name := range names {
+		switch name {
+		case REMOVE_ALLOW_RULES:
+			transformed = filter(transformed, ruleUtils.IsAllowRule)
+		case REMOVE_REGEX_RULES:
+			transformed = filter(transformed, isRegexRule)
+		case SORT:
+			transformed = append([]string{}, transformed...)
+			sort.Strings(transformed)
+		}
+	}
+	return transformed, nil
+}
@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	var rules []string = []string{"||b.org^", "@@||allowed.org^", "/ads[0-9]+\\./", "||a.org^", "@@/track/"}
+
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, rules},
+		{[]string{REMOVE_ALLOW_RULES}, []string{"||b.org^", "/ads[0-9]+\\./", "||a.org^"}},
+		{[]string{REMOVE_REGEX_RULES, SORT}, []string{"@@||allowed.org^", "||a.org^", "||b.org^"}},
+		{[]string{REMOVE_ALLOW_RULES, REMOVE_REGEX_RULES, SORT}, []string{"||a.org^", "||b.org^"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Apply(rules, tt.names)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Apply(%q) = %q, %v, want %q", tt.names, got, err, tt.want)
+		}
+	}
+	if rules[0] != "||b.org^" {
+		t.Errorf("Apply() changed the rules passed in: %q", rules)
+	}
+
+	if _, err := Apply(rules, []string{"invert"}); err == nil {
+		t.Errorf("Apply() with an unknown transformation error = nil")
+	}
+}
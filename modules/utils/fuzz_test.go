@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+var seeds []string = []string{
+	"",
+	"third-party,important",
+	"denyallow=example.com|example.net,important",
+	"domain=a\\,b",
+	"\\,a",
+	",\\,",
+	"a,,b\\",
+	"\\\\,a",
+	"||example.org^",
+	"@@||example.org^$important",
+	"^||example.org",
+}
+
+func FuzzSplitByDelimiterWithEscapeCharacter(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+	f.Fuzz(func(t *testing.T, str string, preserveAllTokens bool) {
+		var parts []string = SplitByDelimiterWithEscapeCharacter(str, ',', '\\', preserveAllTokens)
+
+		// Escaping the delimiter in every token and joining them back must give the same tokens
+		var escaped []string
+		for _, part := range parts {
+			if strings.HasSuffix(part, "\\") || (!preserveAllTokens && part == "") {
+				return
+			}
+			escaped = append(escaped, strings.ReplaceAll(part, ",", "\\,"))
+		}
+		if len(escaped) > 0 && escaped[0] == "" {
+			return
+		}
+
+		var joined string = strings.Join(escaped, ",")
+		var again []string = SplitByDelimiterWithEscapeCharacter(joined, ',', '\\', preserveAllTokens)
+		if strings.Join(again, "\x00") != strings.Join(parts, "\x00") {
+			t.Errorf("%q -> %q -> %q -> %q", str, parts, joined, again)
+		}
+
+		if !strings.Contains(str, "\\") {
+			var want []string
+			for i, part := range strings.Split(str, ",") {
+				if part != "" || (preserveAllTokens && i > 0) {
+					want = append(want, part)
+				}
+			}
+			if strings.Join(want, "\x00") != strings.Join(parts, "\x00") {
+				t.Errorf("%q: got %q, want %q", str, parts, want)
+			}
+		}
+	})
+}
+
+func FuzzSubstringBetween(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		var substring string = SubstringBetween(str, "||", "^")
+		if substring != "" && !strings.Contains(str, "||"+substring+"^") {
+			t.Errorf("SubstringBetween(%q) = %q", str, substring)
+		}
+	})
+}
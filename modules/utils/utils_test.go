@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitByDelimiterWithEscapeCharacter(t *testing.T) {
+	tests := []struct {
+		str               string
+		preserveAllTokens bool
+		want              []string
+	}{
+		{"", false, nil},
+		{"a,b,c", false, []string{"a", "b", "c"}},
+		{"a\\,b,c", false, []string{"a,b", "c"}},
+		{"a,,b", false, []string{"a", "b"}},
+		{"a,,b", true, []string{"a", "", "b"}},
+		{",a", false, []string{"a"}},
+		{"a,", false, []string{"a"}},
+		{"\\,a", false, []string{",a"}},
+		{"a,\\,", false, []string{"a", ","}},
+	}
+
+	for _, tt := range tests {
+		got := SplitByDelimiterWithEscapeCharacter(tt.str, ',', '\\', tt.preserveAllTokens)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitByDelimiterWithEscapeCharacter(%q, %v) = %q, want %q", tt.str, tt.preserveAllTokens, got, tt.want)
+		}
+	}
+}
+
+func TestSubstringBetween(t *testing.T) {
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"", ""},
+		{"||example.org^", "example.org"},
+		{"||example.org^$important", "example.org"},
+		{"^||", ""},
+		{"^||example.org^", "example.org"},
+		{"example.org^", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SubstringBetween(tt.str, "||", "^"); got != tt.want {
+			t.Errorf("SubstringBetween(%q) = %q, want %q", tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{"example", "||example.org^", true},
+		{"example", "||test.org^", false},
+		{"*.example.org", "ads.example.org", true},
+		{"*.example.org", "example.org", false},
+		{"/^ads[0-9]+/", "ads1.example.org", true},
+		{"/^ads[0-9]+/", "example.org", false},
+	}
+
+	for _, tt := range tests {
+		w, err := NewWildcard(tt.pattern)
+		if err != nil {
+			t.Fatalf("NewWildcard(%q) error = %v", tt.pattern, err)
+		}
+		if got := w.Test(tt.str); got != tt.want {
+			t.Errorf("Wildcard(%q).Test(%q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+
+	if _, err := NewWildcard(""); err == nil {
+		t.Errorf("NewWildcard(\"\") error = nil")
+	}
+}
@@ -0,0 +1,37 @@
+package validate
+
+import "strings"
+
+/**
+ * Public suffixes with more than one label that lists tend to block by
+ * mistake, lint warns about the rules blocking one. This is a small excerpt of https://publicsuffix.org/list/,
+ * single-label suffixes (TLDs) never pass HOSTNAME_REGEX anyway.
+ */
+var PUBLIC_SUFFIXES map[string]struct{} = map[string]struct{}{
+	// ICANN section
+	"ac.uk": {}, "co.uk": {}, "gov.uk": {}, "ltd.uk": {}, "me.uk": {}, "net.uk": {}, "org.uk": {}, "plc.uk": {},
+	"com.au": {}, "edu.au": {}, "gov.au": {}, "net.au": {}, "org.au": {},
+	"co.jp": {}, "ne.jp": {}, "or.jp": {}, "ac.jp": {}, "go.jp": {},
+	"co.kr": {}, "or.kr": {}, "ne.kr": {},
+	"com.br": {}, "net.br": {}, "org.br": {}, "gov.br": {},
+	"com.cn": {}, "net.cn": {}, "org.cn": {}, "gov.cn": {},
+	"com.tw": {}, "net.tw": {}, "org.tw": {},
+	"com.hk": {}, "com.sg": {}, "com.my": {}, "com.ph": {}, "com.vn": {},
+	"co.in": {}, "net.in": {}, "org.in": {}, "gov.in": {},
+	"co.nz": {}, "net.nz": {}, "org.nz": {},
+	"co.za": {}, "org.za": {},
+	"com.mx": {}, "com.ar": {}, "com.co": {}, "com.pe": {},
+	"com.tr": {}, "com.ua": {}, "com.pl": {}, "com.ru": {},
+	"co.il": {}, "co.id": {}, "co.th": {},
+	// Private section
+	"github.io": {}, "gitlab.io": {}, "blogspot.com": {}, "appspot.com": {},
+	"herokuapp.com": {}, "cloudfront.net": {}, "azurewebsites.net": {},
+	"netlify.app": {}, "vercel.app": {}, "pages.dev": {}, "workers.dev": {},
+	"firebaseapp.com": {}, "web.app": {}, "s3.amazonaws.com": {},
+}
+
+// The hostname, not one of its subdomains, is a public suffix
+func IsPublicSuffix(hostname string) bool {
+	_, exists := PUBLIC_SUFFIXES[strings.TrimSuffix(strings.ToLower(hostname), ".")]
+	return exists
+}
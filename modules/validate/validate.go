@@ -12,66 +12,65 @@ var (
 	HOSTNAME_REGEX      *regexp.Regexp      = regexp.MustCompile(`(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9][a-z0-9-]{0,61}[a-z0-9]`)
 	SUPPORTED_MODIFIERS map[string]struct{} = map[string]struct{}{"important": {}, "~important": {}, "badfilter": {}, "ctag": {}, "denyallow": {}}
 	MIN_PATTERN_LENGTH  int                 = 5
+	PATTERN_CHARS_REGEX *regexp.Regexp      = regexp.MustCompile(`^[a-zA-Z0-9-.*|^]+$`)
 )
 
-func validHostname(hostname, ruleText string) bool {
-	return HOSTNAME_REGEX.MatchString(hostname)
-	// Todo: Fix this to actually get the WHOIS data
-	/*
-		res, err := whoisLookup(hostname)
-		if err != nil {
-			return false
-		}
-		u, err := url.Parse("http://" + hostname)
-		if err != nil {
-			// hostname invalid
-			return false
-		}
-		parsedHostname := u.Hostname()
-		if err != nil || (parsedHostname == "") || (net.ParseIP(hostname) != nil) {
-			// hostname invalid
-			return false
-		}
-		publicSuffix := getPublicSuffix(parsedHostname)
-		// matching whole public suffix not allowed
-		return parsedHostname != publicSuffix
-	*/
+// Rule IDs of the problems Check reports
+const (
+	UNSUPPORTED_MODIFIER = "unsupported-modifier"
+	PATTERN_TOO_SHORT    = "pattern-too-short"
+	INVALID_PATTERN      = "invalid-pattern"
+	INVALID_HOSTNAME     = "invalid-hostname"
+	// Reported by Suspicious, the compile keeps these rules
+	SUSPICIOUS_RULE = "suspicious-rule"
+	PUBLIC_SUFFIX   = "public-suffix"
+)
+
+/**
+ * Problem is the reason a rule is invalid.
+ * Offset is the byte offset in the rule text the problem starts at.
+ */
+type Problem struct {
+	Rule    string
+	Message string
+	Offset  int
 }
 
-/*
-func getPublicSuffix(hostname string) string {
-	domainParts := strings.Split(hostname, ".")
-	if len(domainParts) < 2 {
-		return ""
+func problemAt(ruleText string, part string, rule string, format string, a ...any) *Problem {
+	var offset int = strings.Index(ruleText, part)
+	if offset == -1 || part == "" {
+		offset = len(ruleText) - len(strings.TrimLeft(ruleText, " \t"))
 	}
-	return domainParts[len(domainParts)-2] + "." + domainParts[len(domainParts)-1]
+	return &Problem{Rule: rule, Message: fmt.Sprintf(format, a...), Offset: offset}
+}
+
+func checkHostname(hostname, ruleText string) *Problem {
+	if !HOSTNAME_REGEX.MatchString(hostname) {
+		return problemAt(ruleText, hostname, INVALID_HOSTNAME, "invalid hostname %q", hostname)
+	}
+	return nil
 }
-*/
 
 /**
  * Validates an /etc/hosts rule.
  *
  * We do one very simple thing:
  * 1. Validate all the hostnames
- * 2. Prohibit rules that block the whole public suffix
- * 3. Prohibit rules that contain invalid domain names
+ * 2. Prohibit rules that contain invalid domain names
  */
-func validEtcHostsRule(ruleText string) bool {
+func checkEtcHostsRule(ruleText string) *Problem {
 	props, err := ruleUtils.LoadEtcHostsRuleProperties(ruleText)
-	if err != nil {
-		return false
-	}
-	if len(props.Hostnames) == 0 {
-		return false
+	if err != nil || len(props.Hostnames) == 0 {
+		return problemAt(ruleText, "", INVALID_HOSTNAME, "/etc/hosts rule without hostnames")
 	}
 
 	for _, hostname := range props.Hostnames {
-		if !validHostname(hostname, ruleText) {
-			return false
+		if problem := checkHostname(hostname, ruleText); problem != nil {
+			return problem
 		}
 	}
 
-	return true
+	return nil
 }
 
 /**
@@ -83,31 +82,32 @@ func validEtcHostsRule(ruleText string) bool {
  * 4. For domain-blocking rules like ||domain^ it checks that the domain is
  * valid and does not block too much.
  */
-func validAdblockRule(ruleText string) bool {
+func checkAdblockRule(ruleText string) *Problem {
 	props := ruleUtils.LoadAdblockRuleProperties(ruleText)
 	if props.Pattern == "" {
-		return false
+		return problemAt(ruleText, "", INVALID_PATTERN, "empty pattern")
 	}
 
 	// 1. It checks if the rule contains only supported modifiers.
-	if len(props.Options) > 0 {
-		for _, option := range props.Options {
-			if _, exists := SUPPORTED_MODIFIERS[option.Name]; !exists {
-				return false
-			}
+	for _, option := range props.Options {
+		if _, exists := SUPPORTED_MODIFIERS[option.Name]; !exists {
+			var modifiers string = ruleText[strings.LastIndex(ruleText, "$")+1:]
+			var problem *Problem = problemAt(modifiers, option.Name, UNSUPPORTED_MODIFIER, "unsupported modifier $%s", option.Name)
+			problem.Offset += len(ruleText) - len(modifiers)
+			return problem
 		}
 	}
 
 	// 2. It checks whether the pattern is not too wide (should be at least 5 characters).
 	if len(props.Pattern) < MIN_PATTERN_LENGTH {
-		return false
+		return problemAt(ruleText, props.Pattern, PATTERN_TOO_SHORT, "pattern %q is shorter than %d characters", props.Pattern, MIN_PATTERN_LENGTH)
 	}
 
 	// 3. If checks if the pattern does not contain characters that cannot be in a domain name.
 	// 3.1. Special case: regex rules
 	// Do nothing with regex rules -- they may contain all kinds of special chars
 	if strings.HasPrefix(props.Pattern, "/") && strings.HasSuffix(props.Pattern, "/") {
-		return true
+		return nil
 	}
 
 	// However, regular adblock-style rules if they match a domain name
@@ -117,9 +117,9 @@ func validAdblockRule(ruleText string) bool {
 	toTest := props.Pattern
 	toTest = strings.TrimPrefix(toTest, "://")
 
-	var checkChars bool = regexp.MustCompile(`^[a-zA-Z0-9-.*|^]+$`).Match([]byte(toTest))
+	var checkChars bool = PATTERN_CHARS_REGEX.MatchString(toTest)
 	if !checkChars {
-		return false
+		return problemAt(ruleText, props.Pattern, INVALID_PATTERN, "pattern %q contains characters that cannot be in a domain name", props.Pattern)
 	}
 
 	// 4. Validate domain name
@@ -128,67 +128,176 @@ func validAdblockRule(ruleText string) bool {
 	var wildcardIdx int = strings.Index(props.Pattern, "*")
 	if sepIdx != -1 && wildcardIdx != -1 && wildcardIdx > sepIdx {
 		// Smth like ||example.org^test* -- invalid
-		return false
+		return problemAt(ruleText, props.Pattern[sepIdx:], INVALID_PATTERN, "wildcard after the ^ separator")
 	}
 
 	if strings.HasPrefix(props.Pattern, "||") && sepIdx != -1 && wildcardIdx != -1 {
-		var hostname string = utils.SubstringBetween(ruleText, "||", "^")
-		if !validHostname(hostname, ruleText) {
-			return false
+		if problem := checkDomainPattern(ruleText, props.Pattern, sepIdx); problem != nil {
+			return problem
 		}
+	}
+
+	return nil
+}
 
-		// If there's something after ^ in the pattern - something went wrong
-		// unless it's `^|` which is a rather often case
-		if (len(props.Pattern) > (sepIdx + 1)) && props.Pattern[sepIdx+1] != '|' {
-			return false
+// Checks the hostname of a ||domain^ pattern and what follows the separator
+func checkDomainPattern(ruleText string, pattern string, sepIdx int) *Problem {
+	var hostname string = utils.SubstringBetween(ruleText, "||", "^")
+	if problem := checkHostname(hostname, ruleText); problem != nil {
+		return problem
+	}
+
+	// If there's something after ^ in the pattern - something went wrong
+	// unless it's `^|` which is a rather often case
+	if (len(pattern) > (sepIdx + 1)) && pattern[sepIdx+1] != '|' {
+		return problemAt(ruleText, pattern[sepIdx:], INVALID_PATTERN, "unexpected %q after the ^ separator", pattern[sepIdx+1:])
+	}
+	return nil
+}
+
+/**
+ * Returns a problem with a rule that Check accepts, nil when there is
+ * none. These rules are kept by the compile, lint reports them as
+ * warnings.
+ *
+ * Check only validates the hostname of the ||domain^ rules with a
+ * wildcard, the hostname of the others is checked here. A rule blocking
+ * a whole public suffix is reported as well.
+ */
+func Suspicious(ruleText string) *Problem {
+	if Check(ruleText) != nil || ruleUtils.IsComment(ruleText) {
+		return nil
+	}
+
+	if ruleUtils.IsEtcHostsRule(ruleText) {
+		props, _ := ruleUtils.LoadEtcHostsRuleProperties(ruleText)
+		for _, hostname := range props.Hostnames {
+			if problem := checkPublicSuffix(hostname, ruleText); problem != nil {
+				return problem
+			}
 		}
+		return nil
 	}
 
-	return true
+	props := ruleUtils.LoadAdblockRuleProperties(ruleText)
+	var sepIdx int = strings.Index(props.Pattern, "^")
+	if !strings.HasPrefix(props.Pattern, "||") || sepIdx == -1 || strings.Contains(props.Pattern, "*") {
+		return nil
+	}
+	if problem := checkDomainPattern(ruleText, props.Pattern, sepIdx); problem != nil {
+		problem.Rule = SUSPICIOUS_RULE
+		return problem
+	}
+	return checkPublicSuffix(utils.SubstringBetween(ruleText, "||", "^"), ruleText)
+}
+
+// Blocking the whole public suffix is most likely a mistake
+func checkPublicSuffix(hostname string, ruleText string) *Problem {
+	if IsPublicSuffix(hostname) {
+		return problemAt(ruleText, hostname, PUBLIC_SUFFIX, "%q is a public suffix", hostname)
+	}
+	return nil
 }
 
 /**
- * Validates the rule.
+ * Checks the rule and returns the reason it is invalid, nil for valid rules.
  *
  * Emptry strings and comments are considered valid.
  *
- * For /etc/hosts rules: utils.validEtcHostsRule
- * For adblock-style rules: utils.validAdblockRule
+ * For /etc/hosts rules: checkEtcHostsRule
+ * For adblock-style rules: checkAdblockRule
  */
-func valid(ruleText string) bool {
+func Check(ruleText string) *Problem {
 	if ruleUtils.IsComment(ruleText) || len(strings.TrimSpace(ruleText)) == 0 {
-		return true
+		return nil
 	}
 
 	if ruleUtils.IsEtcHostsRule(ruleText) {
-		return validEtcHostsRule(ruleText)
+		return checkEtcHostsRule(ruleText)
 	}
 
-	return validAdblockRule(ruleText)
+	return checkAdblockRule(ruleText)
+}
+
+func valid(ruleText string) bool {
+	return Check(ruleText) == nil
+}
+
+/**
+ * Stream validates the rules as they are read.
+ *
+ * Comments and empty lines are held back until the next rule arrives
+ * so that they can be removed together with an invalid rule.
+ * The slice returned by Process is reused on the next call.
+ */
+type Stream struct {
+	filtered []string
+	pending  []string
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Name() string {
+	return "validate"
+}
+
+func (s *Stream) Process(rules []string) []string {
+	s.filtered = s.filtered[:0]
+	for _, ruleText := range rules {
+		if ruleUtils.IsComment(ruleText) || len(ruleText) == 0 {
+			s.pending = append(s.pending, ruleText)
+			continue
+		}
+
+		if valid(ruleText) {
+			s.filtered = append(s.filtered, s.pending...)
+			s.filtered = append(s.filtered, ruleText)
+		}
+		s.pending = s.pending[:0]
+	}
+	return s.filtered
+}
+
+func (s *Stream) Flush() []string {
+	var pending []string = s.pending
+	s.pending = nil
+	return pending
 }
 
 /**
  * Validates all rules
+ *
+ * The rules are marked in a single pass from the end of the list and
+ * copied into a new slice, the caller's slice is left untouched.
  */
 func Validate(rules []string) []string {
-	var filtered []string = rules
+	var keep []bool = make([]bool, len(rules))
+	var kept int = 0
 	var prevRuleRemoved bool = false
 
-	for iFiltered := len(filtered) - 1; iFiltered >= 0; iFiltered -= 1 {
-		var ruleText string = filtered[iFiltered]
+	for i := len(rules) - 1; i >= 0; i -= 1 {
+		var ruleText string = rules[i]
 
 		if !valid(ruleText) {
 			prevRuleRemoved = true
-			filtered = append(filtered[:iFiltered], filtered[iFiltered+1:]...)
 		} else if prevRuleRemoved && (ruleUtils.IsComment(ruleText) || len(ruleText) == 0) {
 			// Remove preceding comments and empty lines
-			filtered = append(filtered[:iFiltered], filtered[iFiltered+1:]...)
 		} else {
 			// Stop removing comments
 			prevRuleRemoved = false
+			keep[i] = true
+			kept += 1
+		}
+	}
+
+	var filtered []string = make([]string, 0, kept)
+	for i, ruleText := range rules {
+		if keep[i] {
+			filtered = append(filtered, ruleText)
 		}
 	}
 
-	fmt.Printf("validate - start: %d\tend: %d\n", len(rules), len(filtered))
 	return filtered
 }
@@ -0,0 +1,163 @@
+package validate
+
+import (
+	"dns-hostlist-compiler/modules/testutils"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// Regenerates the golden files in testdata
+var update *bool = flag.Bool("update", false, "regenerate the golden files in testdata")
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"", true},
+		{"! comment", true},
+		{"||example.org^", true},
+		{"||example.org^$important", true},
+		{"||example.org^$~important,badfilter", true},
+		{"||example.org^$denyallow=example.com", true},
+		{"||example.org^$third-party", false},
+		{"||example.org^$script", false},
+		{"||a^", false},
+		{"@@||example.org^", true},
+		{"/ads[0-9]+/", true},
+		{"||exa_mple.org^", false},
+		{"||example.org^test*", false},
+		{"0.0.0.0 example.org", true},
+		{"0.0.0.0 example.org www.example.org", true},
+		{"0.0.0.0 -example", false},
+		{"||example.org^foo", true},
+		{"||*.example.org^foo", false},
+		{"||co.uk^", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			if got := valid(tt.rule); got != tt.want {
+				t.Errorf("valid(%q) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		rule   string
+		id     string
+		offset int
+	}{
+		{"||example.org^$script", UNSUPPORTED_MODIFIER, 15},
+		{"||example.org^$important,third-party", UNSUPPORTED_MODIFIER, 25},
+		{"||a^", PATTERN_TOO_SHORT, 0},
+		{"||exa_mple.org^", INVALID_PATTERN, 0},
+		{"||example.org^test*", INVALID_PATTERN, 13},
+		{"0.0.0.0 example.org -example", INVALID_HOSTNAME, 20},
+		{"||*.example.org^foo", INVALID_PATTERN, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			var problem *Problem = Check(tt.rule)
+			if problem == nil {
+				t.Fatalf("Check(%q) = nil, want %s", tt.rule, tt.id)
+			}
+			if problem.Rule != tt.id || problem.Offset != tt.offset {
+				t.Errorf("Check(%q) = %s at %d, want %s at %d", tt.rule, problem.Rule, problem.Offset, tt.id, tt.offset)
+			}
+		})
+	}
+}
+
+func TestSuspicious(t *testing.T) {
+	tests := []struct {
+		rule   string
+		id     string
+		offset int
+	}{
+		{"||example.org^foo", SUSPICIOUS_RULE, 13},
+		{"||example-.org^", SUSPICIOUS_RULE, 2},
+		{"||co.uk^", PUBLIC_SUFFIX, 2},
+		{"||GitHub.io^$important", PUBLIC_SUFFIX, 2},
+		{"0.0.0.0 example.org github.io", PUBLIC_SUFFIX, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			var problem *Problem = Suspicious(tt.rule)
+			if problem == nil || problem.Rule != tt.id || problem.Offset != tt.offset {
+				t.Errorf("Suspicious(%q) = %+v, want %s at %d", tt.rule, problem, tt.id, tt.offset)
+			}
+		})
+	}
+
+	for _, rule := range []string{"||example.org^", "||example.org^|", "||*.example.org^", "||a^", "0.0.0.0 example.org", "||user.github.io^", "! comment"} {
+		if problem := Suspicious(rule); problem != nil {
+			t.Errorf("Suspicious(%q) = %+v, want nil", rule, problem)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		want  []string
+	}{
+		{"empty", nil, []string{}},
+		{"keeps valid", []string{"! c", "||example.org^"}, []string{"! c", "||example.org^"}},
+		{"removes preceding comments", []string{"! a", "", "! b", "||a^", "||example.org^"}, []string{"||example.org^"}},
+		{"keeps trailing comments", []string{"||example.org^", "! end"}, []string{"||example.org^", "! end"}},
+		{"keeps comments after invalid", []string{"||a^", "! c", "||example.org^"}, []string{"! c", "||example.org^"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Validate(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDoesNotModifyInput(t *testing.T) {
+	var rules []string = []string{"||a^", "||example.org^", "||b^"}
+	var want []string = append([]string{}, rules...)
+
+	Validate(rules)
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Validate() modified its input: %q", rules)
+	}
+}
+
+func TestValidateGolden(t *testing.T) {
+	testutils.Golden(t, *update, Validate)
+}
+
+func TestStreamMatchesValidate(t *testing.T) {
+	var rules []string = testutils.GenerateCorpus(10_000)
+	var stream *Stream = NewStream()
+
+	var got []string
+	for i := 0; i < len(rules); i += 1000 {
+		got = append(got, stream.Process(rules[i:i+1000])...)
+	}
+	got = append(got, stream.Flush()...)
+
+	if want := Validate(rules); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream returned %d rules, Validate returned %d", len(got), len(want))
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	var rules []string = testutils.GenerateCorpus(2_000_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		Validate(rules)
+	}
+}